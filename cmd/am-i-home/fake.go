@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+	"github.com/bastibuck/am-i-home-cli/internal/router/homestationtest"
+)
+
+// demoHosts is the host table served by the fake router
+var demoHosts = []homestationtest.Host{
+	{MAC: "02:00:5E:10:00:01", IP: "192.168.0.10", Hostname: "alice-phone", Active: true,
+		InterfaceType: "802.11", Band: "5G", SSID: "home", RSSI: -58, IPv6: []string{"fe80::5eff:fe10:1"}, LeaseTime: 3120, ConnectedTime: 5400},
+	{MAC: "00:1B:21:10:00:02", IP: "192.168.0.11", Hostname: "alice-laptop", Active: true,
+		InterfaceType: "802.11", Band: "2.4G", SSID: "home", RSSI: -71, LeaseTime: 2400, ConnectedTime: 86400},
+	{MAC: "02:00:5E:10:00:03", IP: "192.168.0.12", Hostname: "bob-phone", Active: false,
+		InterfaceType: "802.11", Band: "5G", SSID: "home"},
+	{MAC: "00:0E:58:10:00:04", IP: "192.168.0.13", Hostname: "living-room-tv", Active: true,
+		InterfaceType: "Ethernet", LeaseTime: 3500, ConnectedTime: 172800},
+	{MAC: "02:00:5E:10:00:05", IP: "192.168.0.14", Hostname: "guest-tablet", Active: false},
+}
+
+// The fake backend runs an in-process HomeStation emulator with demo devices
+// so the CLI can be tried out without a router. bob-phone joins and leaves
+// every 30 seconds to have something to watch.
+func init() {
+	router.RegisterBackend("fake", router.Backend{New: newFakeClient, Emulated: true})
+}
+
+// fakeClient is the HomeStation client of the fake backend. Closing it also
+// stops the emulator.
+type fakeClient struct {
+	*router.HomeStationClient
+	srv    *homestationtest.Server
+	ticker *time.Ticker
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newFakeClient(cfg router.Config) (router.RouterClient, error) {
+	hosts := append([]homestationtest.Host(nil), demoHosts...)
+	srv := homestationtest.NewServer(cfg.User, cfg.Pass, hosts)
+
+	cfg.BaseURL = srv.URL
+	// the emulator's sessions end with the process
+	cfg.Sessions = nil
+	rc, err := router.New("homestation", cfg)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	c := &fakeClient{HomeStationClient: rc.(*router.HomeStationClient), srv: srv, ticker: time.NewTicker(30 * time.Second), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case <-c.ticker.C:
+				hosts = append([]homestationtest.Host(nil), hosts...)
+				hosts[2].Active = !hosts[2].Active
+				srv.SetHosts(hosts)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// Close logs out and stops the emulator
+func (c *fakeClient) Close() error {
+	err := c.HomeStationClient.Close()
+	c.once.Do(func() {
+		c.ticker.Stop()
+		close(c.done)
+		c.srv.Close()
+	})
+	return err
+}
@@ -1,37 +1,109 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strings"
 	"syscall"
-
-	"golang.org/x/term"
+	"time"
 
 	"github.com/bastibuck/am-i-home-cli/internal/cli"
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/history"
+	"github.com/bastibuck/am-i-home-cli/internal/metrics"
+	"github.com/bastibuck/am-i-home-cli/internal/mqtt"
+	"github.com/bastibuck/am-i-home-cli/internal/notify"
+	"github.com/bastibuck/am-i-home-cli/internal/oui"
+	"github.com/bastibuck/am-i-home-cli/internal/presence"
 	"github.com/bastibuck/am-i-home-cli/internal/router"
+	"github.com/bastibuck/am-i-home-cli/internal/server"
 )
 
 func usage() {
-	fmt.Fprintf(flag.CommandLine.Output(), "am-i-home - check if a device is connected to your Vodafone HomeStation\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "am-i-home - check if a device is connected to your Vodafone HomeStation (or OpenWrt router)\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "\nUsage:\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "  am-i-home\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "    Show this help\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> login [-store keyring|file] [-delete] [-no-verify]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Stores the password for -user at -router in the keyring or an encrypted file, so it needn't be passed again\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> logout [-force]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Logs out a router session left open by a killed am-i-home run (alias reset-session)\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> list\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "    Returns a list of all active devices\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> list-all\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "    Returns a list of all devices ever connected\n")
-	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> check <MATCHER>\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Both list commands accept -columns, e.g. -columns mac,hostname,band,signal or -columns all\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> check [-any|-all|-none] <MATCHER>...\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "    Returns 'true' or 'false' and exits 0 if MATCHER is present, 1 if absent, 2 on error\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    (3 wrong credentials, 4 another router session active, 5 router unreachable, 6 unexpected router response,\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    7 router certificate not trusted)\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    MATCHER is a MAC, hostname or IP, optionally prefixed with mac:, host: or ip:, and may be\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    a glob (aa:bb:cc:*, *-phone), a /regexp/ or a CIDR range (192.168.0.0/24). The prefixes\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    ipv6:, iface:, band:, ssid:, vendor: and signal: (e.g. signal:>-65) match further details\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> who\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Lists all people from the config file and whether they are home\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> check-person <NAME>\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Returns 'true' if any device of NAME is present; exit codes as for check\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> history [MATCHER] [-since 7d]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Prints recorded arrivals and departures (of MATCHER) from the -history file\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> report [PERSON|MATCHER] [-since 7d] [-by day|week]\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Summarizes time at home, typical arrival/departure and longest absence per person and device\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> watch\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Polls the router every -interval and prints joined/left/ip-changed events until interrupted\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> serve\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Serves GET /devices, /devices/active and /check/<MATCHER> as JSON and /metrics for Prometheus on -listen\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "\n  am-i-home <FLAGS> mqtt\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "    Publishes devices as Home Assistant device_trackers to -mqtt-broker every -interval\n")
 	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
 	flag.PrintDefaults()
 }
 
 func main() {
+	configPath := flag.String("config", config.DefaultPath(), "config file with profiles and people")
+	profileName := flag.String("profile", "", "config profile to use (falls back to AM_I_HOME_PROFILE env, then default_profile)")
 	routerHost := flag.String("router", "http://192.168.0.1", "router ip address")
-	pass := flag.String("pass", "", "router admin password (falls back to AM_I_HOME_ROUTER_PASS env, then .env, else interactive prompt)")
+	routerType := flag.String("router-type", "homestation", "router backend: "+strings.Join(router.Backends(), ", "))
+	pass := flag.String("pass", "", "router admin password, visible to other local users; prefer -pass-file, -pass-command or the login command (falls back to the profile, then AM_I_HOME_ROUTER_PASS env, then a stored login, then .env, else interactive prompt)")
+	passFile := flag.String("pass-file", "", "read the router admin password from the first line of this file")
+	passCommand := flag.String("pass-command", "", "read the router admin password from the first line of this command's output, e.g. \"pass show router\"")
 	user := flag.String("user", "admin", "router admin username")
+	timeout := flag.Duration("timeout", router.DefaultTimeout, "timeout for each phase of talking to the router (salt, login, host table, logout) unless set below")
+	saltTimeout := flag.Duration("salt-timeout", 0, "timeout for requesting the login salt (default -timeout)")
+	loginTimeout := flag.Duration("login-timeout", 0, "timeout for logging in and activating the session (default -timeout)")
+	tableTimeout := flag.Duration("table-timeout", 0, "timeout for fetching the host table (default -timeout)")
+	logoutTimeout := flag.Duration("logout-timeout", 0, "timeout for logging out, which is attempted even when interrupted (default -timeout)")
+	retries := flag.Int("retries", router.DefaultRetryPolicy.MaxAttempts-1, "additional attempts to log in or fetch the host table after a transient error such as a timeout or a rebooting router")
+	retryBackoff := flag.Duration("retry-backoff", router.DefaultRetryPolicy.InitialBackoff, "wait before the first retry, doubled for every further one (up to 5s) with some random jitter")
+	lockoutWait := flag.Duration("lockout-wait", 0, "wait this long and log in again when the router refuses because another session is active (MSG_LOGIN_150), 0 to fail right away")
+	caFile := flag.String("ca-file", "", "PEM file with certificates to trust for an https:// router in addition to the system's, e.g. its self-signed certificate")
+	tlsFingerprint := flag.String("tls-fingerprint", "", "accept only the https:// router certificate with this SHA-256 fingerprint (default: pin the certificate on first use)")
+	insecureSkipVerify := flag.Bool("insecure-skip-verify", false, "don't verify the certificate of an https:// router at all (insecure)")
+	logLevel := flag.String("log-level", "warn", "log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log format: text or json (logs go to stderr)")
+	debug := flag.Bool("debug", false, "log at debug level including every HTTP exchange with the router, with passwords, hashes, cookies and tokens redacted")
+	output := flag.String("output", "table", "output format: table, json, ndjson, csv, tsv or yaml")
+	columnList := flag.String("columns", "", "comma-separated columns for list and list-all: "+strings.Join(cli.ColumnNames(), ", ")+" or all (default mac,ip,hostname,active; the table also shows the vendor)")
+	historyPath := flag.String("history", "", "file recording every observed host table, empty to disable (default ~/.local/state/am-i-home/history.jsonl)")
+	historyRetention := flag.String("history-retention", "", "drop recorded host tables older than this, e.g. 90d (default keep everything)")
+	linkMACs := flag.Bool("link-macs", false, "link rotated randomized MAC addresses that reported the same distinctive hostname using the -history file, for linked: matchers")
+	awayAfter := flag.Duration("away-after", 0, "debounce: only report a device as gone once it has not been seen for this long")
+	awayMisses := flag.Int("away-misses", 0, "debounce: only report a device as gone after this many consecutive polls without it")
+	homeHits := flag.Int("home-hits", 0, "debounce: only report a device as present after this many consecutive polls with it")
+	stateTTL := flag.Duration("state-ttl", 0, "debounce: discard the state when the previous poll is older than this (default -away-after plus 15m)")
+	interval := flag.Duration("interval", 30*time.Second, "polling interval for the watch and mqtt commands")
+	listen := flag.String("listen", "127.0.0.1:8080", "listen address for the serve command")
+	cacheTTL := flag.Duration("cache-ttl", 10*time.Second, "how long the serve command caches router results")
+	mqttBroker := flag.String("mqtt-broker", "tcp://127.0.0.1:1883", "MQTT broker for the mqtt command")
+	mqttUser := flag.String("mqtt-user", "", "MQTT username")
+	mqttPass := flag.String("mqtt-pass", "", "MQTT password")
+	mqttClientID := flag.String("mqtt-client-id", "am-i-home", "MQTT client id")
+	mqttDiscovery := flag.String("mqtt-discovery-prefix", "homeassistant", "Home Assistant MQTT discovery prefix")
+	mqttTopic := flag.String("mqtt-topic", "am-i-home", "base topic for device state, attributes and availability")
 
 	flag.Usage = usage
 
@@ -46,105 +118,620 @@ func main() {
 		os.Exit(0)
 	}
 
+	// remember which flags were given explicitly, they take precedence over the profile
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// a missing config file is only an error if -config was given explicitly
+	cfg, err := config.Load(*configPath, set["config"])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := cfg.CheckMatchers(func(expr string) error {
+		_, err := router.ParseMatcher(expr)
+		return err
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		os.Exit(2)
+	}
+
+	if !set["profile"] {
+		*profileName = os.Getenv("AM_I_HOME_PROFILE")
+	}
+	profile, err := cfg.Profile(*profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !set["router"] && profile.Router != "" {
+		*routerHost = profile.Router
+	}
+	if !set["router-type"] && profile.RouterType != "" {
+		*routerType = profile.RouterType
+	}
+	if !set["user"] && profile.User != "" {
+		*user = profile.User
+	}
+	if !set["timeout"] && profile.Timeout != 0 {
+		*timeout = profile.Timeout
+	}
+	if !set["salt-timeout"] && profile.SaltTimeout != 0 {
+		*saltTimeout = profile.SaltTimeout
+	}
+	if !set["login-timeout"] && profile.LoginTimeout != 0 {
+		*loginTimeout = profile.LoginTimeout
+	}
+	if !set["table-timeout"] && profile.TableTimeout != 0 {
+		*tableTimeout = profile.TableTimeout
+	}
+	if !set["logout-timeout"] && profile.LogoutTimeout != 0 {
+		*logoutTimeout = profile.LogoutTimeout
+	}
+	if !set["retries"] && profile.Retries >= 0 {
+		*retries = profile.Retries
+	}
+	if !set["retry-backoff"] && profile.RetryBackoff != 0 {
+		*retryBackoff = profile.RetryBackoff
+	}
+	if !set["lockout-wait"] && profile.LockoutWait != 0 {
+		*lockoutWait = profile.LockoutWait
+	}
+	if !set["ca-file"] && profile.CAFile != "" {
+		*caFile = profile.CAFile
+	}
+	if !set["tls-fingerprint"] && profile.TLSFingerprint != "" {
+		*tlsFingerprint = profile.TLSFingerprint
+	}
+	if !set["insecure-skip-verify"] && profile.InsecureSkipVerify {
+		*insecureSkipVerify = true
+	}
+	if !set["link-macs"] && profile.LinkMACs {
+		*linkMACs = true
+	}
+	if !set["output"] && profile.Output != "" {
+		*output = profile.Output
+	}
+	if !set["away-after"] && profile.AwayAfter != 0 {
+		*awayAfter = profile.AwayAfter
+	}
+	if !set["away-misses"] && profile.AwayMisses != 0 {
+		*awayMisses = profile.AwayMisses
+	}
+	if !set["home-hits"] && profile.HomeHits != 0 {
+		*homeHits = profile.HomeHits
+	}
+	if !set["state-ttl"] && profile.StateTTL != 0 {
+		*stateTTL = profile.StateTTL
+	}
+
+	format, err := cli.ParseFormat(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	columns, err := cli.ParseColumns(*columnList)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logger, err := newLogger(*logLevel, *logFormat, *debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// person devices may refer to aliases of the selected profile
+	for i, p := range cfg.People {
+		devices := make([]string, len(p.Devices))
+		for j, d := range p.Devices {
+			devices[j] = profile.Resolve(d)
+		}
+		cfg.People[i].Devices = devices
+	}
+	webhooks := notifyWebhooks(cfg.Webhooks, profile)
+	if err := notify.Validate(webhooks); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		os.Exit(2)
+	}
+
+	if !set["history"] {
+		*historyPath = history.DefaultPath(profile.Name)
+	}
+	if !set["history-retention"] && profile.HistoryRetention != "" {
+		*historyRetention = profile.HistoryRetention
+	}
+	var retention time.Duration
+	if *historyRetention != "" {
+		if retention, err = history.ParseSince(*historyRetention); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -history-retention:", err)
+			os.Exit(2)
+		}
+	}
+
+	// commands working on recorded data don't need the router
+	if args[0] == "history" {
+		runHistory(args[1:], *historyPath, profile, format)
+		return
+	}
+	if args[0] == "report" {
+		runReport(args[1:], *historyPath, cfg, profile, format)
+		return
+	}
+
 	// ensure user flag is provided
 	if strings.TrimSpace(*user) == "" {
 		fmt.Fprintln(os.Stderr, "--user is required")
 		os.Exit(2)
 	}
 
-	// prompt for password flag if not provided
-	if *pass == "" {
-		// 1) Check for environment variable
-		if v, ok := os.LookupEnv("AM_I_HOME_ROUTER_PASS"); ok && v != "" {
-			*pass = v
-		} else {
-			// 2) Try to read a .env file in the current working directory
-			if b, err := os.ReadFile(".env"); err == nil {
-				// parse simple KEY=VALUE lines
-				for line := range strings.SplitSeq(string(b), "\n") {
-					line = strings.TrimSpace(line)
-					if line == "" || strings.HasPrefix(line, "#") {
-						continue
-					}
-					parts := strings.SplitN(line, "=", 2)
-					if len(parts) != 2 {
-						continue
-					}
-					key := strings.TrimSpace(parts[0])
-					val := strings.TrimSpace(parts[1])
-					if len(val) >= 2 {
-						if (val[0] == '\'' && val[len(val)-1] == '\'') || (val[0] == '"' && val[len(val)-1] == '"') {
-							val = val[1 : len(val)-1]
-						}
-					}
-					if key == "AM_I_HOME_ROUTER_PASS" && val != "" {
-						*pass = val
-						break
-					}
-				}
-			}
+	timeouts := router.Timeouts{Salt: *saltTimeout, Login: *loginTimeout, Table: *tableTimeout, Logout: *logoutTimeout}
+	retry := router.DefaultRetryPolicy
+	retry.MaxAttempts = *retries + 1
+	retry.InitialBackoff = *retryBackoff
+	retry.LockoutWait = *lockoutWait
+	backend, err := router.LookupBackend(*routerType)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed creating router client:", err)
+		os.Exit(2)
+	}
+	// sessions are recorded until logged out, so that the next run can end
+	// a session left open by a killed process
+	var sessions *router.SessionStore
+	if path := router.DefaultSessionPath(); path != "" && !backend.Emulated {
+		sessions = router.NewSessionStore(path)
+	}
+	tlsConfig := router.TLSConfig{CAFile: *caFile, Fingerprint: *tlsFingerprint, InsecureSkipVerify: *insecureSkipVerify}
+	if !backend.Emulated {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		tlsConfig, err = resolveTLS(ctx, *routerHost, tlsConfig, pinStore(*configPath))
+		cancel()
+		if err != nil {
+			fail(err)
 		}
+	}
+	// login and logout retry and report like the other commands
+	collector := metrics.NewCollector()
+	routerCfg := router.Config{
+		BaseURL:  *routerHost,
+		User:     *user,
+		Timeout:  *timeout,
+		Timeouts: timeouts,
+		Sessions: sessions,
+		Retry:    retry,
+		Observer: collector,
+		Logger:   logger,
+		Trace:    *debug,
+		TLS:      tlsConfig,
+	}
+	passFlags := passwordFlags{pass: *pass, file: *passFile, command: *passCommand}
+	if args[0] == "login" {
+		runLogin(args[1:], passFlags, *routerType, routerCfg)
+		return
+	}
+	if args[0] == "logout" || args[0] == "reset-session" {
+		runLogout(args[1:], *routerType, backend, routerCfg)
+		return
+	}
 
-		if *pass == "" {
-			// only attempt an interactive prompt when stdin is a terminal
-			if term.IsTerminal(int(syscall.Stdin)) {
-				fmt.Printf("Password for %s@%s: ", *user, *routerHost)
-				p, err := term.ReadPassword(int(syscall.Stdin))
-				fmt.Println()
-				if err != nil {
-					fmt.Fprintln(os.Stderr, "failed reading password:", err)
-					os.Exit(2)
-				}
-				*pass = string(p)
-			} else {
-				fmt.Fprintln(os.Stderr, "--pass is required when not running interactively and AM_I_HOME_ROUTER_PASS not set")
-				os.Exit(2)
-			}
+	// resolve the password (an emulated router accepts any password)
+	if !backend.Emulated {
+		p, err := resolvePassword(passFlags, profile, *user, *routerHost)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
 		}
+		*pass = p
 	}
+	routerCfg.Pass = *pass
+
+	// installed after the password prompt, which an interrupt should abort
+	ctx, stop := interruptContext()
+	defer stop()
 
-	// create HomeStation client (uses cookiejar internally)
-	hs, err := router.NewHomeStationClient(*routerHost, *user, *pass)
+	// create the router client for the selected backend
+	rc, err := router.New(*routerType, routerCfg)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "failed creating HomeStation client:", err)
+		fmt.Fprintln(os.Stderr, "failed creating router client:", err)
 		os.Exit(2)
 	}
 
+	if *historyPath != "" {
+		store := history.Open(*historyPath)
+		store.Retention = retention
+		warn := func(err error) {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+		rc = &history.Recorder{RouterClient: rc, Store: store, OnError: warn}
+		if *linkMACs {
+			// link rotated randomized MAC addresses to the device they replaced
+			rc = &history.Linker{RouterClient: rc, Store: store, OnError: warn}
+		}
+	}
+
+	// debounce after recording, so the history keeps what the router reported
+	if policy := (presence.Policy{AwayAfter: *awayAfter, AwayMisses: *awayMisses, HomeHits: *homeHits, StateTTL: *stateTTL}); policy.Enabled() {
+		rc = &presence.Debouncer{
+			RouterClient: rc,
+			Policy:       policy,
+			Path:         presence.DefaultPath(profile.Name),
+			OnError: func(err error) {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			},
+		}
+	}
+
 	switch args[0] {
 	case "list-all":
-		if err := cli.ListDevices(hs); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
-			os.Exit(2)
+		if err := cli.ListDevices(ctx, rc, format, columns); err != nil {
+			fail(err)
 		}
 
 	case "list":
-		if err := cli.ListActive(hs); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
-			os.Exit(2)
+		if err := cli.ListActive(ctx, rc, format, columns); err != nil {
+			fail(err)
 		}
 
 	case "check":
-		if len(args) < 2 {
+		fs := flag.NewFlagSet("check", flag.ExitOnError)
+		anyOf := fs.Bool("any", false, "succeed if any matcher finds an active device (default)")
+		allOf := fs.Bool("all", false, "succeed if every matcher finds an active device")
+		noneOf := fs.Bool("none", false, "succeed if no matcher finds an active device")
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
 			fmt.Fprintln(os.Stderr, "check command requires a matcher argument")
 			os.Exit(2)
 		}
-		matcher := args[1]
-		found, err := cli.CheckByMatcher(hs, matcher)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+
+		quantifier := cli.QuantifierAny
+		switch {
+		case *anyOf && (*allOf || *noneOf) || *allOf && *noneOf:
+			fmt.Fprintln(os.Stderr, "only one of -any, -all and -none may be given")
 			os.Exit(2)
+		case *allOf:
+			quantifier = cli.QuantifierAll
+		case *noneOf:
+			quantifier = cli.QuantifierNone
+		}
+
+		matchers := make([]string, fs.NArg())
+		for i, m := range fs.Args() {
+			matchers[i] = profile.Resolve(m)
+		}
+		warnRandomized(matchers, *historyPath != "" && *linkMACs)
+		found, err := cli.CheckMatchers(ctx, rc, quantifier, matchers)
+		if err != nil {
+			fail(err)
 		}
 
-		fmt.Println(found)
+		if err := cli.PrintCheckResult(os.Stdout, format, strings.Join(fs.Args(), " "), found); err != nil {
+			fail(err)
+		}
 		if found {
 			os.Exit(0)
 		}
 
 		os.Exit(1)
 
+	case "who":
+		if len(cfg.People) == 0 {
+			fmt.Fprintln(os.Stderr, "no people configured in", *configPath)
+			os.Exit(2)
+		}
+		if err := cli.Who(ctx, rc, cfg.People, format); err != nil {
+			fail(err)
+		}
+
+	case "check-person":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "check-person command requires a name argument")
+			os.Exit(2)
+		}
+		name := args[1]
+		person, ok := cfg.Person(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown person %q\n", name)
+			os.Exit(2)
+		}
+		warnRandomized(person.Devices, *historyPath != "" && *linkMACs)
+		home, err := cli.CheckPerson(ctx, rc, person)
+		if err != nil {
+			fail(err)
+		}
+
+		if err := cli.PrintCheckResult(os.Stdout, format, name, home); err != nil {
+			fail(err)
+		}
+		if home {
+			os.Exit(0)
+		}
+
+		os.Exit(1)
+
+	case "watch":
+		var handlers []func(time.Time, router.Event)
+		var n *notify.Notifier
+		if len(webhooks) > 0 {
+			if n, err = newNotifier(webhooks); err != nil {
+				fail(err)
+			}
+			handlers = append(handlers, n.Notify)
+		}
+
+		err := cli.Watch(ctx, rc, *interval, format, handlers...)
+		if n != nil {
+			// deliver the queued events before exiting
+			n.Close()
+		}
+		if err != nil {
+			fail(err)
+		}
+
+	case "serve":
+		if err := server.New(rc, *cacheTTL, server.WithMetrics(collector), server.WithAliases(profile.Aliases)).Serve(ctx, *listen); err != nil {
+			fail(err)
+		}
+
+	case "mqtt":
+		mc, err := mqtt.Dial(*mqttBroker, mqtt.Options{
+			ClientID:  *mqttClientID,
+			Username:  *mqttUser,
+			Password:  *mqttPass,
+			KeepAlive: time.Minute,
+			Will:      mqtt.Will(*mqttTopic),
+		})
+		if err != nil {
+			fail(err)
+		}
+
+		pub := mqtt.NewPublisher(mc, *mqttDiscovery, *mqttTopic)
+		err = cli.PublishMQTT(ctx, rc, pub, *interval)
+		mc.Close()
+		if err != nil {
+			fail(err)
+		}
+
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
 		usage()
 		os.Exit(2)
 	}
 }
+
+// interruptContext returns a context cancelled by SIGINT, SIGTERM or SIGHUP.
+// Router clients still log out when cancelled; a second interrupt exits
+// right away.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// Exit codes besides 0 (found), 1 (not found) and 2 (any other error)
+const (
+	exitBadCredentials = 3
+	exitSessionActive  = 4
+	exitUnreachable    = 5
+	exitProtocol       = 6
+	exitCertificate    = 7
+	exitInterrupted    = 130
+)
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, router.ErrBadCredentials):
+		return exitBadCredentials
+	case errors.Is(err, router.ErrSessionActive):
+		return exitSessionActive
+	case errors.Is(err, router.ErrUnreachable):
+		return exitUnreachable
+	case errors.Is(err, router.ErrProtocol):
+		return exitProtocol
+	case errors.Is(err, router.ErrCertificate):
+		return exitCertificate
+	}
+	return 2
+}
+
+// fail prints err and exits with its exit code
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(exitCode(err))
+}
+
+// newLogger creates the stderr logger passed to the router backends. -debug
+// overrides the level.
+func newLogger(level, format string, debug bool) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+	if debug {
+		lvl = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+}
+
+// warnRandomized warns about matchers selecting a randomized MAC address,
+// which the device may replace at any time
+func warnRandomized(matchers []string, linking bool) {
+	for _, m := range matchers {
+		mac, ok := router.MatcherMAC(m)
+		if !ok || !oui.LocallyAdministered(mac) {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s is a randomized (locally administered) MAC address that the device may rotate; prefer matching its hostname", mac)
+		if linking {
+			fmt.Fprintf(os.Stderr, " or linked:%s to follow rotated addresses\n", mac)
+		} else {
+			fmt.Fprintln(os.Stderr, " or enable -link-macs to follow rotated addresses")
+		}
+	}
+}
+
+// notifyWebhooks converts the configured webhooks, resolving device aliases
+// of the profile
+func notifyWebhooks(webhooks []config.Webhook, profile config.Profile) []notify.Webhook {
+	hooks := make([]notify.Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		h := notify.Webhook{
+			Name:     w.Name,
+			URL:      w.URL,
+			Type:     w.Type,
+			Template: w.Template,
+			Secret:   w.Secret,
+			Token:    w.Token,
+			Retries:  w.Retries,
+			Timeout:  w.Timeout,
+		}
+		for _, e := range w.Events {
+			h.Events = append(h.Events, router.EventKind(e))
+		}
+		for _, d := range w.Devices {
+			h.Devices = append(h.Devices, profile.Resolve(d))
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks
+}
+
+// newNotifier creates a notifier delivering to hooks
+func newNotifier(hooks []notify.Webhook) (*notify.Notifier, error) {
+	return notify.New(hooks, notify.WithErrorHandler(func(err error) {
+		fmt.Fprintln(os.Stderr, "notification failed:", err)
+	}))
+}
+
+// parseRecordedArgs parses the arguments of commands reading the presence
+// history: the command's flags (registered on fs, plus -since) and an
+// optional subject that may come before or after them
+func parseRecordedArgs(fs *flag.FlagSet, args []string, path string) (string, time.Duration) {
+	since := fs.String("since", "7d", "how far back to look, e.g. 12h, 7d or 2w")
+	fs.Parse(args)
+
+	subject := ""
+	if fs.NArg() > 0 {
+		subject = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, fs.Name(), "accepts at most one argument")
+		os.Exit(2)
+	}
+
+	period, err := history.ParseSince(*since)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "history is disabled (-history is empty)")
+		os.Exit(2)
+	}
+	return subject, period
+}
+
+// runLogout implements the logout command, ending a router session
+// recorded by a run that was killed before it could log out
+func runLogout(args []string, routerType string, backend router.Backend, cfg router.Config) {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	force := fs.Bool("force", false, "also log out a session whose am-i-home process is still running")
+	fs.Parse(args)
+
+	if backend.Emulated {
+		fmt.Fprintf(os.Stderr, "the %s backend's sessions end with the process, there is nothing to log out\n", routerType)
+		os.Exit(1)
+	}
+	if cfg.Sessions == nil {
+		fmt.Fprintln(os.Stderr, "no state directory to record sessions in")
+		os.Exit(2)
+	}
+	rc, err := router.New(routerType, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed creating router client:", err)
+		os.Exit(2)
+	}
+	r, ok := rc.(router.SessionResetter)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "the %s backend does not record sessions\n", routerType)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	key := router.SessionKey(cfg.User, cfg.BaseURL)
+	done, err := r.ResetSession(ctx, *force)
+	if errors.Is(err, router.ErrSessionInUse) {
+		fmt.Fprintf(os.Stderr, "error: %v, stop it first or use -force\n", err)
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if !done {
+		fmt.Fprintf(os.Stderr, "no open session recorded for %s; if the router still refuses logins, wait for its session to time out or log out in its web interface\n", key)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "logged out the session of %s\n", key)
+}
+
+// runHistory implements the history command
+func runHistory(args []string, path string, profile config.Profile, format cli.Format) {
+	expr, since := parseRecordedArgs(flag.NewFlagSet("history", flag.ExitOnError), args, path)
+	var matcher router.Matcher
+	if expr != "" {
+		m, err := router.ParseMatcher(profile.Resolve(expr))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		matcher = m
+	}
+
+	if err := cli.History(history.Open(path), matcher, since, format); err != nil {
+		fail(err)
+	}
+}
+
+// runReport implements the report command
+func runReport(args []string, path string, cfg *config.Config, profile config.Profile, format cli.Format) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	by := fs.String("by", "", "break present hours down by \"day\" or \"week\"")
+	subject, since := parseRecordedArgs(fs, args, path)
+	if _, isPerson := cfg.Person(subject); subject != "" && !isPerson {
+		subject = profile.Resolve(subject)
+	}
+
+	var bucket *history.Bucket
+	switch *by {
+	case "":
+	case "day":
+		b := history.BucketDay
+		bucket = &b
+	case "week":
+		b := history.BucketWeek
+		bucket = &b
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -by %q (expected day or week)\n", *by)
+		os.Exit(2)
+	}
+
+	if err := cli.Report(history.Open(path), cfg.People, subject, since, bucket, format); err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/credentials"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// passwordFlags are the explicit password sources given on the command line
+type passwordFlags struct {
+	pass, file, command string
+}
+
+// read returns the password from the explicit source, "" if none is given
+func (p passwordFlags) read() (string, error) {
+	n := 0
+	for _, s := range []string{p.pass, p.file, p.command} {
+		if s != "" {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return "", fmt.Errorf("only one of -pass, -pass-file and -pass-command may be given")
+	case p.file != "":
+		return config.ReadPasswordFile(p.file)
+	case p.command != "":
+		return config.RunPasswordCommand(p.command)
+	}
+	return p.pass, nil
+}
+
+// resolvePassword returns the router password from the first source that
+// has one: the -pass, -pass-file and -pass-command flags, the profile, the
+// AM_I_HOME_ROUTER_PASS environment variable, a credential stored by the
+// login command, a .env file, else an interactive prompt.
+func resolvePassword(flags passwordFlags, profile config.Profile, user, routerHost string) (string, error) {
+	// 1) Explicit flags
+	if v, err := flags.read(); err != nil || v != "" {
+		return v, err
+	}
+
+	// 2) Use the credential source of the selected profile, which names the
+	// password of its router, while the environment variable may have been
+	// exported for another one
+	if v, err := profile.ReadPassword(); err != nil || v != "" {
+		return v, err
+	}
+
+	// 3) Check for environment variable
+	if v, ok := os.LookupEnv("AM_I_HOME_ROUTER_PASS"); ok && v != "" {
+		return v, nil
+	}
+
+	// 4) Use a credential stored by the login command
+	path := credentials.DefaultFilePath()
+	stores := credentials.Stores(path, passphrase(path, false))
+	v, err := credentials.Lookup(stores, credentials.Key(user, routerHost))
+	if err != nil && !errors.Is(err, credentials.ErrNotFound) {
+		return "", err
+	}
+	if v != "" {
+		return v, nil
+	}
+
+	// 5) Try to read a .env file in the current working directory
+	if v := readDotEnv(".env"); v != "" {
+		return v, nil
+	}
+
+	// only attempt an interactive prompt when stdin is a terminal
+	if !term.IsTerminal(int(syscall.Stdin)) {
+		return "", fmt.Errorf("--pass is required when not running interactively and AM_I_HOME_ROUTER_PASS not set (or store it with am-i-home login, setting AM_I_HOME_PASSPHRASE for an encrypted file)")
+	}
+	return promptSecret(fmt.Sprintf("Password for %s@%s: ", user, routerHost))
+}
+
+// readDotEnv returns AM_I_HOME_ROUTER_PASS from the .env file at path, ""
+// if the file or the key is missing
+func readDotEnv(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	// parse simple KEY=VALUE lines
+	for line := range strings.SplitSeq(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		val := strings.TrimSpace(parts[1])
+		if len(val) >= 2 {
+			if (val[0] == '\'' && val[len(val)-1] == '\'') || (val[0] == '"' && val[len(val)-1] == '"') {
+				val = val[1 : len(val)-1]
+			}
+		}
+		if key == "AM_I_HOME_ROUTER_PASS" && val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// promptSecret reads a secret from the terminal without echoing it
+func promptSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(int(syscall.Stdin))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed reading password: %w", err)
+	}
+	return string(p), nil
+}
+
+// passphrase returns the passphrase source for the encrypted credentials
+// file at path: AM_I_HOME_PASSPHRASE, else a prompt. With confirm, a new
+// file's passphrase has to be entered twice.
+func passphrase(path string, confirm bool) func() (string, error) {
+	return func() (string, error) {
+		if v := os.Getenv("AM_I_HOME_PASSPHRASE"); v != "" {
+			return v, nil
+		}
+		if !term.IsTerminal(int(syscall.Stdin)) {
+			return "", fmt.Errorf("%w: AM_I_HOME_PASSPHRASE is required to unlock %s when not running interactively", credentials.ErrNoPassphrase, path)
+		}
+
+		_, err := os.Stat(path)
+		if !confirm || !errors.Is(err, fs.ErrNotExist) {
+			return promptSecret(fmt.Sprintf("Passphrase for %s: ", path))
+		}
+		p, err := promptSecret(fmt.Sprintf("New passphrase for %s: ", path))
+		if err != nil {
+			return "", err
+		}
+		again, err := promptSecret("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if p != again {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+		return p, nil
+	}
+}
+
+// runLogin implements the login command, storing the router password in
+// the keyring or the encrypted credentials file
+func runLogin(args []string, flags passwordFlags, routerType string, cfg router.Config) {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	storeName := fs.String("store", "", "where to store the password: keyring or file (default keyring if available, else file)")
+	remove := fs.Bool("delete", false, "delete the stored password instead")
+	noVerify := fs.Bool("no-verify", false, "store the password without logging into the router first")
+	fs.Parse(args)
+
+	path := credentials.DefaultFilePath()
+	keyring := credentials.NewKeyring()
+	var store credentials.Store
+	switch *storeName {
+	case "":
+		if keyring.Available() {
+			store = keyring
+		} else {
+			store = &credentials.File{Path: path, Passphrase: passphrase(path, true)}
+		}
+	case "keyring":
+		if !keyring.Available() {
+			fmt.Fprintln(os.Stderr, "the keyring is not available: secret-tool and a D-Bus session are required")
+			os.Exit(2)
+		}
+		store = keyring
+	case "file":
+		store = &credentials.File{Path: path, Passphrase: passphrase(path, true)}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown store %q, expected keyring or file\n", *storeName)
+		os.Exit(2)
+	}
+	key := credentials.Key(cfg.User, cfg.BaseURL)
+
+	if *remove {
+		if err := store.Delete(key); err != nil {
+			if errors.Is(err, credentials.ErrNotFound) {
+				fmt.Fprintf(os.Stderr, "no password stored for %s in %s\n", key, store.Name())
+				os.Exit(1)
+			}
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "deleted password for %s from %s\n", key, store.Name())
+		return
+	}
+
+	pass, err := flags.read()
+	if err == nil && pass == "" {
+		if term.IsTerminal(int(syscall.Stdin)) {
+			pass, err = promptSecret(fmt.Sprintf("Password for %s: ", key))
+		} else {
+			// e.g. pass show router | am-i-home login
+			pass, err = bufio.NewReader(os.Stdin).ReadString('\n')
+			if err == io.EOF {
+				err = nil
+			}
+			pass = strings.TrimRight(pass, "\r\n")
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+	if pass == "" {
+		fmt.Fprintln(os.Stderr, "no password given")
+		os.Exit(2)
+	}
+
+	if !*noVerify {
+		ctx, stop := interruptContext()
+		defer stop()
+		cfg.Pass = pass
+		rc, err := router.New(routerType, cfg)
+		if err == nil {
+			_, err = router.ListConnectedContext(ctx, rc)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: password not stored, logging into the router failed:", err)
+			os.Exit(exitCode(err))
+		}
+	}
+
+	if err := store.Set(key, pass); err != nil {
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "stored password for %s in %s\n", key, store.Name())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// pinStore returns the store for certificates trusted on first use, the
+// known_routers file next to the config file, or nil without a config path
+func pinStore(configPath string) *router.PinStore {
+	if configPath == "" {
+		return nil
+	}
+	return router.NewPinStore(filepath.Join(filepath.Dir(configPath), "known_routers"))
+}
+
+// resolveTLS returns how the certificate of an https:// router is verified.
+// Without -ca-file, -tls-fingerprint or -insecure-skip-verify, a certificate
+// the system doesn't trust is pinned in pins on first use and required from
+// then on. A router the system trusts is recorded as such, so that later
+// runs neither probe it nor pin a certificate it switches to.
+func resolveTLS(ctx context.Context, baseURL string, c router.TLSConfig, pins *router.PinStore) (router.TLSConfig, error) {
+	if !strings.HasPrefix(strings.ToLower(baseURL), "https://") {
+		return c, nil
+	}
+	if c.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, "warning: -insecure-skip-verify is set, the router's certificate is not verified and the password may be intercepted")
+		return c, nil
+	}
+	if c.CAFile != "" || c.Fingerprint != "" || pins == nil {
+		return c, nil
+	}
+
+	key := router.PinKey(baseURL)
+	fingerprint, ok, err := pins.Get(key)
+	if err != nil {
+		return c, err
+	}
+	if ok {
+		if fingerprint != router.SystemTrusted {
+			c.Fingerprint = fingerprint
+		}
+		return c, nil
+	}
+
+	fingerprint, trusted, err := router.ProbeCertificate(ctx, baseURL)
+	if err != nil {
+		return c, err
+	}
+	if trusted {
+		return c, pins.Put(key, router.SystemTrusted)
+	}
+	if err := pins.Put(key, fingerprint); err != nil {
+		return c, err
+	}
+	fmt.Fprintf(os.Stderr, "warning: trusting the certificate of %s on first use, SHA-256 fingerprint %s (pinned in %s)\n", key, fingerprint, pins.Path())
+	c.Fingerprint = fingerprint
+	return c, nil
+}
@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// column is a device attribute that can be selected with -columns
+type column struct {
+	name   string // name on the command line
+	key    string // record key, the router.Device json tag
+	header string // table header
+	// value returns the typed value used by machine-readable formats
+	value func(router.Device) any
+	// text returns the table cell, empty if the value is unknown
+	text func(router.Device) string
+}
+
+// addrList renders a list of addresses comma-separated in CSV, TSV, YAML
+// and table output while still being a JSON array
+type addrList []string
+
+func (a addrList) String() string {
+	return strings.Join(a, ",")
+}
+
+// columns lists all selectable columns in their default order
+var columns = []column{
+	{"mac", "mac", "MAC",
+		func(d router.Device) any { return d.MAC },
+		func(d router.Device) string { return d.MAC }},
+	{"ip", "ip", "IP",
+		func(d router.Device) any { return d.IP },
+		func(d router.Device) string { return d.IP }},
+	{"hostname", "hostname", "Hostname",
+		func(d router.Device) any { return d.Hostname },
+		func(d router.Device) string { return d.Hostname }},
+	{"active", "active", "Active",
+		func(d router.Device) any { return d.Active },
+		func(d router.Device) string { return strconv.FormatBool(d.Active) }},
+	{"interface", "interface", "Interface",
+		func(d router.Device) any { return d.Interface },
+		func(d router.Device) string { return d.Interface }},
+	{"band", "band", "Band",
+		func(d router.Device) any { return d.Band },
+		func(d router.Device) string { return d.Band }},
+	{"ssid", "ssid", "SSID",
+		func(d router.Device) any { return d.SSID },
+		func(d router.Device) string { return d.SSID }},
+	{"signal", "signal", "Signal",
+		func(d router.Device) any { return d.Signal },
+		func(d router.Device) string {
+			if d.Signal == 0 {
+				return ""
+			}
+			return strconv.Itoa(d.Signal) + " dBm"
+		}},
+	{"ipv6", "ipv6", "IPv6",
+		func(d router.Device) any { return append(addrList{}, d.IPv6...) },
+		func(d router.Device) string { return addrList(d.IPv6).String() }},
+	{"lease", "lease_seconds", "Lease",
+		func(d router.Device) any { return d.LeaseSeconds },
+		func(d router.Device) string { return seconds(d.LeaseSeconds) }},
+	{"connected", "connected_seconds", "Connected",
+		func(d router.Device) any { return d.ConnectedSeconds },
+		func(d router.Device) string { return seconds(d.ConnectedSeconds) }},
+	{"vendor", "vendor", "Vendor",
+		func(d router.Device) any { return d.Vendor },
+		func(d router.Device) string {
+			if d.Vendor == "" && d.Randomized {
+				return "(randomized MAC)"
+			}
+			return d.Vendor
+		}},
+	{"randomized", "randomized", "Randomized",
+		func(d router.Device) any { return d.Randomized },
+		func(d router.Device) string { return strconv.FormatBool(d.Randomized) }},
+	{"linked", "linked_macs", "Linked MACs",
+		func(d router.Device) any { return append(addrList{}, d.LinkedMACs...) },
+		func(d router.Device) string { return addrList(d.LinkedMACs).String() }},
+}
+
+// DefaultColumns are the columns of list-all unless -columns is given. The
+// table additionally shows the vendor (DefaultTableColumns), while
+// machine-readable formats keep their schema.
+var (
+	DefaultColumns      = []string{"mac", "ip", "hostname", "active"}
+	DefaultTableColumns = []string{"mac", "ip", "hostname", "vendor", "active"}
+)
+
+// seconds renders a number of seconds as a duration, empty if unknown
+func seconds(s int64) string {
+	if s <= 0 {
+		return ""
+	}
+	return (time.Duration(s) * time.Second).String()
+}
+
+// ColumnNames returns the names of all selectable columns in their default
+// order
+func ColumnNames() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// ParseColumns parses a comma-separated list of column names. "all" selects
+// every column; an empty list selects the default columns (nil). Columns
+// named more than once are kept at their first position.
+func ParseColumns(s string) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "":
+			continue
+		case name == "all":
+			for _, c := range columns {
+				add(c.name)
+			}
+		case lookupColumn(name) == nil:
+			return nil, fmt.Errorf("unknown column %q, expected one of %s or all", name, strings.Join(ColumnNames(), ", "))
+		default:
+			add(name)
+		}
+	}
+	return names, nil
+}
+
+func lookupColumn(name string) *column {
+	for i := range columns {
+		if columns[i].name == name {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// PrintDevices renders the named columns of devs. The table format prints
+// human-readable cells with headers, all other formats typed values keyed
+// like the router.Device JSON fields.
+func PrintDevices(w io.Writer, format Format, devs []router.Device, names []string) error {
+	cols := make([]*column, len(names))
+	for i, name := range names {
+		if cols[i] = lookupColumn(name); cols[i] == nil {
+			return fmt.Errorf("unknown column %q", name)
+		}
+	}
+	table := format == FormatTable || format == ""
+
+	// build a struct type with one field per column so that PrintRecords
+	// and PrintStructTable can render it like any other record
+	fields := make([]reflect.StructField, len(cols))
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		typ := reflect.TypeOf("")
+		if !table {
+			typ = reflect.TypeOf(c.value(router.Device{}))
+		}
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q`, c.key)),
+		}
+		headers[i] = c.header
+	}
+	typ := reflect.StructOf(fields)
+
+	items := reflect.MakeSlice(reflect.SliceOf(typ), len(devs), len(devs))
+	for i, d := range devs {
+		item := items.Index(i)
+		for j, c := range cols {
+			if table {
+				item.Field(j).SetString(c.text(d))
+			} else {
+				item.Field(j).Set(reflect.ValueOf(c.value(d)))
+			}
+		}
+	}
+
+	return PrintRecords(w, format, items.Interface(), headers)
+}
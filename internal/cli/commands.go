@@ -1,54 +1,140 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
 
 	"github.com/bastibuck/am-i-home-cli/internal/router"
 )
 
-// ListDevices prints devices from the provided RouterClient
-func ListDevices(c router.RouterClient) error {
-	devs, err := c.ListConnected()
+// ListDevices prints devices from the provided RouterClient. columns
+// selects the columns (see ParseColumns), the default columns if empty.
+func ListDevices(ctx context.Context, c router.RouterClient, format Format, columns []string) error {
+	devs, err := router.ListConnectedContext(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	return PrintStructTable(os.Stdout, devs, []string{"MAC", "IP", "Hostname", "Active"})
-}
-
-// activeDevice is a display struct for active devices (without Active field)
-type activeDevice struct {
-	MAC      string
-	IP       string
-	Hostname string
+	if len(columns) == 0 {
+		columns = DefaultColumns
+		if format == FormatTable {
+			columns = DefaultTableColumns
+		}
+	}
+	return PrintDevices(os.Stdout, format, devs, columns)
 }
 
-// ListActive prints only devices marked as active by the router
-func ListActive(c router.RouterClient) error {
-	devs, err := c.ListConnected()
+// ListActive prints only devices marked as active by the router. Without
+// explicit columns the table omits the Active column, while machine-readable
+// formats keep the list-all schema so both can be consumed by the same
+// parser.
+func ListActive(ctx context.Context, c router.RouterClient, format Format, columns []string) error {
+	devs, err := router.ListConnectedContext(ctx, c)
 	if err != nil {
 		return err
 	}
 
-	var active []activeDevice
+	active := []router.Device{}
 	for _, d := range devs {
 		if d.Active {
-			active = append(active, activeDevice{MAC: d.MAC, IP: d.IP, Hostname: d.Hostname})
+			active = append(active, d)
 		}
 	}
 
-	return PrintStructTable(os.Stdout, active, []string{"MAC", "IP", "Hostname"})
+	if len(columns) == 0 {
+		columns = DefaultColumns
+		if format == FormatTable {
+			columns = []string{"mac", "ip", "hostname", "vendor"}
+		}
+	}
+	return PrintDevices(os.Stdout, format, active, columns)
+}
+
+func CheckByMatcher(ctx context.Context, c router.RouterClient, matcher string) (bool, error) {
+	return CheckMatchers(ctx, c, QuantifierAny, []string{matcher})
 }
 
-func CheckByMatcher(c router.RouterClient, matcher string) (bool, error) {
-	devs, err := c.ListConnected()
+// Quantifier combines the results of several matchers in CheckMatchers
+type Quantifier string
+
+const (
+	// QuantifierAny requires at least one matcher to find an active device
+	QuantifierAny Quantifier = "any"
+	// QuantifierAll requires every matcher to find an active device
+	QuantifierAll Quantifier = "all"
+	// QuantifierNone requires no matcher to find an active device
+	QuantifierNone Quantifier = "none"
+)
+
+// CheckMatchers reports whether the active devices satisfy the matchers
+// under quantifier q. Matchers are expressions as accepted by
+// router.ParseMatcher; invalid expressions are an error.
+func CheckMatchers(ctx context.Context, c router.RouterClient, q Quantifier, matchers []string) (bool, error) {
+	compiled := make([]router.Matcher, 0, len(matchers))
+	for _, m := range matchers {
+		cm, err := router.ParseMatcher(m)
+		if err != nil {
+			return false, err
+		}
+		compiled = append(compiled, cm)
+	}
+
+	devs, err := router.ListConnectedContext(ctx, c)
 	if err != nil {
 		return false, err
 	}
-	for _, d := range devs {
-		if d.Active && (router.MatchMAC(d.MAC, matcher) || d.Hostname == matcher || d.IP == matcher) {
-			return true, nil
+
+	found := 0
+	for _, m := range compiled {
+		for _, d := range devs {
+			if d.Active && m(d) {
+				found++
+				break
+			}
 		}
 	}
-	return false, nil
+
+	switch q {
+	case QuantifierAll:
+		return found == len(compiled), nil
+	case QuantifierNone:
+		return found == 0, nil
+	}
+	return found > 0, nil
+}
+
+// checkResult is the machine-readable result of the check command
+type checkResult struct {
+	Matcher string `json:"matcher"`
+	Found   bool   `json:"found"`
+}
+
+// PrintCheckResult prints the result of a check. The table format keeps the
+// bare true/false output; JSON and YAML print a single object.
+func PrintCheckResult(w io.Writer, format Format, matcher string, found bool) error {
+	res := checkResult{Matcher: matcher, Found: found}
+
+	switch format {
+	case FormatTable, "":
+		_, err := fmt.Fprintln(w, found)
+		return err
+
+	case FormatJSON:
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+
+	case FormatYAML:
+		_, err := fmt.Fprintf(w, "matcher: %s\nfound: %t\n", strconv.Quote(matcher), found)
+		return err
+	}
+
+	return PrintRecords(w, format, []checkResult{res}, nil)
 }
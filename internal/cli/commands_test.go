@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/history"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+func TestCheckMatchers(t *testing.T) {
+	c := staticClient{
+		{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "alice-phone", Active: true},
+		{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "bob-phone", Active: false},
+	}
+
+	tests := []struct {
+		q        Quantifier
+		matchers []string
+		want     bool
+	}{
+		{QuantifierAny, []string{"alice-phone", "bob-phone"}, true},
+		{QuantifierAll, []string{"alice-phone", "bob-phone"}, false},
+		{QuantifierAll, []string{"alice-phone", "192.168.0.0/24"}, true},
+		{QuantifierNone, []string{"bob-phone"}, true},
+		{QuantifierNone, []string{"*-phone"}, false},
+		{QuantifierAny, []string{"mac:aa:bb:cc:*"}, true},
+	}
+	for _, tt := range tests {
+		got, err := CheckMatchers(context.Background(), c, tt.q, tt.matchers)
+		if err != nil {
+			t.Fatalf("%s %v: unexpected error: %v", tt.q, tt.matchers, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %v: got %t, want %t", tt.q, tt.matchers, got, tt.want)
+		}
+	}
+
+	if _, err := CheckMatchers(context.Background(), c, QuantifierAny, []string{"/(/"}); err == nil {
+		t.Error("expected error for invalid matcher")
+	}
+}
+
+// ensure matcher expressions are also understood by people's devices
+func TestActiveMatchersPatterns(t *testing.T) {
+	devs := []router.Device{{MAC: "AA:BB:CC:DD:EE:01", Hostname: "alice-phone", Active: true}}
+	if got, err := activeMatchers(devs, config.Person{Devices: []string{"host:alice-*", "host:bob-*"}}); err != nil || len(got) != 1 {
+		t.Errorf("expected only the alice glob to match, got %v, %v", got, err)
+	}
+	if _, err := activeMatchers(devs, config.Person{Name: "alice", Devices: []string{"/[a-/"}}); err == nil {
+		t.Error("expected an error for an invalid matcher")
+	}
+}
+
+func TestHistoryEntries(t *testing.T) {
+	at := func(min int) time.Time { return time.Date(2026, 10, 1, 8, min, 0, 0, time.UTC) }
+	phone := router.Device{MAC: "AA:BB:CC:DD:EE:01", Hostname: "phone", Active: true}
+	printer := router.Device{MAC: "AA:BB:CC:DD:EE:02", Hostname: "printer"}
+	snaps := []history.Snapshot{
+		{Time: at(0), Devices: []router.Device{printer}},
+		{Time: at(1), Devices: []router.Device{phone, printer}},
+		{Time: at(2), Devices: []router.Device{phone, printer}},
+		// recording stopped for longer than history.MaxGap
+		{Time: at(40), Devices: []router.Device{printer}},
+	}
+
+	entries := historyEntries(history.Devices(snaps, history.MaxGap), nil)
+	if len(entries) != 2 {
+		t.Fatalf("expected a session and a device never active, got %+v", entries)
+	}
+	if e := entries[0]; e.dev.Hostname != "printer" || e.iv != nil || !e.dev.FirstSeen.Equal(at(0)) || !e.dev.LastSeen.IsZero() {
+		t.Errorf("expected the printer without a session first, got %+v", e)
+	}
+	if e := entries[1]; e.dev.Hostname != "phone" || e.iv == nil || !e.iv.Interrupted || !e.dev.LastSeen.Equal(at(2)) {
+		t.Errorf("expected the phone's interrupted session, got %+v", e)
+	}
+
+	m, _ := router.ParseMatcher("phone")
+	if entries := historyEntries(history.Devices(snaps, history.MaxGap), m); len(entries) != 1 {
+		t.Errorf("expected only the phone's session, got %+v", entries)
+	}
+}
+
+// flakySessionClient is a SessionClient whose first logins fail
+type flakySessionClient struct {
+	mu            sync.Mutex
+	loginFailures int
+	logins, polls int
+	closed        bool
+}
+
+func (c *flakySessionClient) Login() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logins++
+	if c.loginFailures > 0 {
+		c.loginFailures--
+		return &router.Error{Kind: router.ErrUnreachable, Err: errors.New("rebooting")}
+	}
+	return nil
+}
+
+func (c *flakySessionClient) ListConnected() ([]router.Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.polls++
+	return nil, nil
+}
+
+func (c *flakySessionClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestWatchRetriesLogin(t *testing.T) {
+	c := &flakySessionClient{loginFailures: 2}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	if err := Watch(ctx, c, 10*time.Millisecond, FormatTable); err != nil {
+		t.Fatalf("expected the watch to survive failed logins, got %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.logins != 3 || c.polls == 0 || !c.closed {
+		t.Errorf("expected 3 logins, polls after the last and a logout, got %d logins, %d polls, closed %v", c.logins, c.polls, c.closed)
+	}
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/history"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// sessionRow is a display struct for one presence session
+type sessionRow struct {
+	MAC       string
+	Hostname  string
+	FirstSeen string
+	LastSeen  string
+	Arrived   string
+	Left      string
+	Duration  string
+}
+
+// sessionRecord is the machine-readable form of a presence session. A
+// device that was never active gets one record without a session.
+type sessionRecord struct {
+	MAC       string `json:"mac"`
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname"`
+	FirstSeen string `json:"first_seen"`
+	LastSeen  string `json:"last_seen"` // last time active, empty if never
+	Arrived   string `json:"arrived"`
+	// Left is empty while the device is still present and when recording
+	// stopped before it left (Interrupted)
+	Left            string `json:"left"`
+	Interrupted     bool   `json:"interrupted"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// historyEntry is a session of a device, or a device without sessions
+type historyEntry struct {
+	dev history.DeviceHistory
+	iv  *history.Interval
+}
+
+// start returns when the entry begins, for sorting
+func (e historyEntry) start() time.Time {
+	if e.iv == nil {
+		return e.dev.FirstSeen
+	}
+	return e.iv.Start
+}
+
+// historyEntries returns the sessions of the devices matching m (all if m is
+// nil) sorted by arrival, plus an entry for each device never active
+func historyEntries(hs []history.DeviceHistory, m router.Matcher) []historyEntry {
+	var entries []historyEntry
+	for _, h := range hs {
+		if m != nil && !m(h.Device()) {
+			continue
+		}
+		if len(h.Sessions) == 0 {
+			entries = append(entries, historyEntry{dev: h})
+		}
+		for i := range h.Sessions {
+			entries = append(entries, historyEntry{h, &h.Sessions[i]})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].start().Before(entries[j].start()) })
+	return entries
+}
+
+// History prints the arrival/departure timeline of all devices (or those
+// matching matcher, if not nil) recorded in the store within the last since, with
+// when each device was first and last seen
+func History(store *history.Store, matcher router.Matcher, since time.Duration, format Format) error {
+	snaps, err := store.Load(time.Now().Add(-since))
+	if err != nil {
+		return err
+	}
+	entries := historyEntries(history.Devices(snaps, history.MaxGap), matcher)
+
+	if format != FormatTable {
+		records := make([]sessionRecord, 0, len(entries))
+		for _, e := range entries {
+			r := sessionRecord{
+				MAC:       e.dev.MAC,
+				IP:        e.dev.IP,
+				Hostname:  e.dev.Hostname,
+				FirstSeen: e.dev.FirstSeen.Format(time.RFC3339),
+			}
+			if !e.dev.LastSeen.IsZero() {
+				r.LastSeen = e.dev.LastSeen.Format(time.RFC3339)
+			}
+			if e.iv != nil {
+				r.Arrived = e.iv.Start.Format(time.RFC3339)
+				r.Interrupted = e.iv.Interrupted
+				r.DurationSeconds = int64(e.iv.Duration().Seconds())
+				if !e.iv.Open && !e.iv.Interrupted {
+					r.Left = e.iv.End.Format(time.RFC3339)
+				}
+			}
+			records = append(records, r)
+		}
+		return PrintRecords(os.Stdout, format, records, nil)
+	}
+
+	const layout = "2006-01-02 15:04"
+	rows := make([]sessionRow, 0, len(entries))
+	for _, e := range entries {
+		row := sessionRow{
+			MAC:       e.dev.MAC,
+			Hostname:  e.dev.Hostname,
+			FirstSeen: e.dev.FirstSeen.Local().Format(layout),
+			LastSeen:  "(never active)",
+			Arrived:   "-",
+			Left:      "-",
+			Duration:  "-",
+		}
+		if !e.dev.LastSeen.IsZero() {
+			row.LastSeen = e.dev.LastSeen.Local().Format(layout)
+		}
+		if e.iv != nil {
+			row.Arrived = e.iv.Start.Local().Format(layout)
+			row.Duration = e.iv.Duration().Round(time.Minute).String()
+			switch {
+			case e.iv.Open:
+				row.Left = "(present)"
+			case e.iv.Interrupted:
+				// recording stopped, the duration is up to the last sighting
+				row.Left = "(unknown)"
+			default:
+				row.Left = e.iv.End.Local().Format(layout)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return PrintStructTable(os.Stdout, rows, []string{"MAC", "Hostname", "First seen", "Last seen", "Arrived", "Left", "Duration"})
+}
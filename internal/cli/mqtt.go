@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/mqtt"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// PublishMQTT polls the router every interval and publishes all devices to
+// Home Assistant through p until ctx is cancelled. Availability is set to
+// online while running and offline on shutdown. Polling errors are printed
+// to stderr; a broken MQTT connection ends the command.
+func PublishMQTT(ctx context.Context, c router.RouterClient, p *mqtt.Publisher, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	if s, ok := c.(router.SessionClient); ok {
+		if err := s.Login(); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	if err := p.SetStatus(mqtt.StatusOnline); err != nil {
+		return err
+	}
+	defer p.SetStatus(mqtt.StatusOffline)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Publish only writes on changes, so a lost connection would go
+		// unnoticed while nothing changes
+		if err := p.Err(); err != nil {
+			return fmt.Errorf("failed publishing to MQTT: %w", err)
+		}
+
+		devs, err := router.ListConnectedContext(ctx, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				// interrupted while polling
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, "poll failed:", err)
+		} else if err := p.Publish(devs); err != nil {
+			return fmt.Errorf("failed publishing to MQTT: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.Done():
+			return fmt.Errorf("failed publishing to MQTT: %w", p.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Format selects how command output is rendered
+type Format string
+
+const (
+	FormatTable  Format = "table"
+	FormatJSON   Format = "json"
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+	FormatTSV    Format = "tsv"
+	FormatYAML   Format = "yaml"
+)
+
+// Formats lists all supported output formats
+var Formats = []Format{FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatTSV, FormatYAML}
+
+// ParseFormat validates an output format name (case-insensitive)
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range Formats {
+		if f == known {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q", s)
+}
+
+// recordField is an exported struct field together with its record key
+type recordField struct {
+	index int
+	name  string
+}
+
+// recordFields returns the exported fields of a struct type in declaration
+// order. The record key is taken from the `json` tag, falling back to the
+// lowercased field name. Fields tagged `json:"-"` are skipped.
+func recordFields(t reflect.Type) ([]recordField, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("records must be structs or pointers to structs")
+	}
+
+	var fields []recordField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.ToLower(f.Name)
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields = append(fields, recordField{index: i, name: name})
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no exported fields found in struct")
+	}
+	return fields, nil
+}
+
+// PrintRecords renders a slice of structs (or pointers to structs) in the
+// given format. The table format delegates to PrintStructTable with headers;
+// all other formats use the record keys from recordFields and ignore headers.
+func PrintRecords(w io.Writer, format Format, items interface{}, headers []string) error {
+	if format == FormatTable || format == "" {
+		return PrintStructTable(w, items, headers)
+	}
+
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("items must be a slice")
+	}
+
+	rw, err := newRecordWriter(w, format, v.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		// a single array rather than one object per record
+		if v.Len() == 0 {
+			_, err := fmt.Fprintln(w, "[]")
+			return err
+		}
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	if format == FormatYAML && v.Len() == 0 {
+		_, err := fmt.Fprintln(w, "[]")
+		return err
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := rw.write(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return rw.flush()
+}
+
+// recordWriter writes records one at a time so that it can also be used for
+// streaming output (e.g. the watch command). JSON is written as one object
+// per line, identical to NDJSON.
+type recordWriter struct {
+	w          io.Writer
+	format     Format
+	fields     []recordField
+	csv        *csv.Writer
+	headerDone bool
+}
+
+func newRecordWriter(w io.Writer, format Format, elemType reflect.Type) (*recordWriter, error) {
+	fields, err := recordFields(elemType)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &recordWriter{w: w, format: format, fields: fields}
+	switch format {
+	case FormatCSV:
+		rw.csv = csv.NewWriter(w)
+	case FormatTSV:
+		rw.csv = csv.NewWriter(w)
+		rw.csv.Comma = '\t'
+	case FormatJSON, FormatNDJSON, FormatYAML:
+	default:
+		return nil, fmt.Errorf("format %q does not support records", format)
+	}
+	return rw, nil
+}
+
+// write renders a single struct (or pointer to struct) value
+func (rw *recordWriter) write(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch rw.format {
+	case FormatJSON, FormatNDJSON:
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(rw.w, string(b))
+		return err
+
+	case FormatCSV, FormatTSV:
+		if !rw.headerDone {
+			header := make([]string, len(rw.fields))
+			for i, f := range rw.fields {
+				header[i] = f.name
+			}
+			if err := rw.csv.Write(header); err != nil {
+				return err
+			}
+			rw.headerDone = true
+		}
+		row := make([]string, len(rw.fields))
+		for i, f := range rw.fields {
+			row[i] = fmt.Sprint(v.Field(f.index).Interface())
+		}
+		if err := rw.csv.Write(row); err != nil {
+			return err
+		}
+		return nil
+
+	case FormatYAML:
+		for i, f := range rw.fields {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			if _, err := fmt.Fprintf(rw.w, "%s%s: %s\n", prefix, f.name, yamlScalar(v.Field(f.index))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("format %q does not support records", rw.format)
+}
+
+// flush writes out any buffered output
+func (rw *recordWriter) flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		return rw.csv.Error()
+	}
+	return nil
+}
+
+// yamlScalar renders a field value as a YAML scalar. Strings are always
+// double-quoted so values like "true" or "01" keep their type.
+func yamlScalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return strconv.Quote(fmt.Sprint(v.Interface()))
+}
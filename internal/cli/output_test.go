@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, in := range []string{"table", "JSON", " ndjson ", "csv", "tsv", "yaml"} {
+		if _, err := ParseFormat(in); err != nil {
+			t.Errorf("ParseFormat(%q) returned error: %v", in, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestPrintRecords(t *testing.T) {
+	type Device struct {
+		MAC    string `json:"mac"`
+		Name   string `json:"hostname"`
+		Active bool   `json:"active"`
+	}
+	devices := []Device{
+		{MAC: "aa:bb", Name: "phone", Active: true},
+		{MAC: "cc:dd", Name: "my, laptop", Active: false},
+	}
+
+	tests := []struct {
+		format   Format
+		items    interface{}
+		expected string
+	}{
+		{
+			format: FormatJSON,
+			items:  devices,
+			expected: `[
+  {
+    "mac": "aa:bb",
+    "hostname": "phone",
+    "active": true
+  },
+  {
+    "mac": "cc:dd",
+    "hostname": "my, laptop",
+    "active": false
+  }
+]
+`,
+		},
+		{
+			format:   FormatJSON,
+			items:    []Device(nil),
+			expected: "[]\n",
+		},
+		{
+			format: FormatNDJSON,
+			items:  devices,
+			expected: `{"mac":"aa:bb","hostname":"phone","active":true}
+{"mac":"cc:dd","hostname":"my, laptop","active":false}
+`,
+		},
+		{
+			format: FormatCSV,
+			items:  devices,
+			expected: `mac,hostname,active
+aa:bb,phone,true
+cc:dd,"my, laptop",false
+`,
+		},
+		{
+			format:   FormatTSV,
+			items:    devices,
+			expected: "mac\thostname\tactive\naa:bb\tphone\ttrue\ncc:dd\tmy, laptop\tfalse\n",
+		},
+		{
+			format: FormatYAML,
+			items:  devices,
+			expected: `- mac: "aa:bb"
+  hostname: "phone"
+  active: true
+- mac: "cc:dd"
+  hostname: "my, laptop"
+  active: false
+`,
+		},
+		{
+			format:   FormatYAML,
+			items:    []Device{},
+			expected: "[]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := PrintRecords(&buf, tt.format, tt.items, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.format, err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tt.format, tt.expected, buf.String())
+		}
+	}
+
+	t.Run("table format uses PrintStructTable", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := PrintRecords(&buf, FormatTable, devices, []string{"MAC", "Hostname", "Active"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(buf.String(), "MAC   | Hostname   | Active\n") {
+			t.Errorf("unexpected table output:\n%s", buf.String())
+		}
+	})
+}
+
+func TestPrintCheckResult(t *testing.T) {
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{FormatTable, "true\n"},
+		{FormatJSON, "{\n  \"matcher\": \"phone\",\n  \"found\": true\n}\n"},
+		{FormatNDJSON, "{\"matcher\":\"phone\",\"found\":true}\n"},
+		{FormatCSV, "matcher,found\nphone,true\n"},
+		{FormatYAML, "matcher: \"phone\"\nfound: true\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := PrintCheckResult(&buf, tt.format, "phone", true); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.format, err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.format, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestPrintDevices(t *testing.T) {
+	devs := []router.Device{
+		{MAC: "aa:bb", Hostname: "phone", Active: true, Band: "5GHz", Signal: -58, IPv6: []string{"fe80::1", "2001:db8::1"}},
+		{MAC: "cc:dd", Hostname: "tv", Active: true, Interface: router.InterfaceEthernet},
+	}
+
+	tests := []struct {
+		format   Format
+		columns  []string
+		expected string
+	}{
+		{FormatCSV, DefaultColumns, "mac,ip,hostname,active\naa:bb,,phone,true\ncc:dd,,tv,true\n"},
+		{FormatCSV, []string{"hostname", "signal", "ipv6"}, "hostname,signal,ipv6\nphone,-58,\"fe80::1,2001:db8::1\"\ntv,0,\n"},
+		{FormatNDJSON, []string{"mac", "ipv6"}, `{"mac":"aa:bb","ipv6":["fe80::1","2001:db8::1"]}` + "\n" + `{"mac":"cc:dd","ipv6":[]}` + "\n"},
+		{FormatTable, []string{"hostname", "band", "signal"}, "Hostname | Band | Signal \n-------------------------\nphone    | 5GHz | -58 dBm\ntv       |      |        \n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := PrintDevices(&buf, tt.format, devs, tt.columns); err != nil {
+			t.Fatalf("%s %v: unexpected error: %v", tt.format, tt.columns, err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s %v: expected:\n%q\ngot:\n%q", tt.format, tt.columns, tt.expected, buf.String())
+		}
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	if cols, err := ParseColumns(""); err != nil || cols != nil {
+		t.Errorf("ParseColumns(\"\") = %v, %v; want defaults", cols, err)
+	}
+	if cols, _ := ParseColumns("all"); len(cols) != len(columns) {
+		t.Errorf("expected all to select %d columns, got %v", len(columns), cols)
+	}
+	if cols, _ := ParseColumns(" MAC, band "); !reflect.DeepEqual(cols, []string{"mac", "band"}) {
+		t.Errorf("unexpected columns %v", cols)
+	}
+	if cols, _ := ParseColumns("mac,ip,mac"); !reflect.DeepEqual(cols, []string{"mac", "ip"}) {
+		t.Errorf("expected duplicates to be dropped, got %v", cols)
+	}
+	if cols, _ := ParseColumns("all,mac"); !reflect.DeepEqual(cols, ColumnNames()) {
+		t.Errorf("expected all columns once, got %v", cols)
+	}
+	if _, err := ParseColumns("mac,rssi"); err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
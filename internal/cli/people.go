@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// personStatus is a display struct for the who command
+type personStatus struct {
+	Name          string `json:"name"`
+	Home          bool   `json:"home"`
+	ActiveDevices string `json:"active_devices"`
+}
+
+// personMatchers compiles the person's device matchers. Invalid matchers
+// are an error.
+func personMatchers(p config.Person) ([]router.Matcher, error) {
+	matchers := make([]router.Matcher, 0, len(p.Devices))
+	for _, expr := range p.Devices {
+		m, err := router.ParseMatcher(expr)
+		if err != nil {
+			return nil, fmt.Errorf("person %s: %w", p.Name, err)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// activeMatchers returns the person's device matchers that are currently
+// active
+func activeMatchers(devs []router.Device, p config.Person) ([]string, error) {
+	matchers, err := personMatchers(p)
+	if err != nil {
+		return nil, err
+	}
+	var active []string
+	for i, m := range matchers {
+		for _, d := range devs {
+			if d.Active && m(d) {
+				active = append(active, p.Devices[i])
+				break
+			}
+		}
+	}
+	return active, nil
+}
+
+// Who prints every configured person and whether any of their devices is active
+func Who(ctx context.Context, c router.RouterClient, people []config.Person, format Format) error {
+	devs, err := router.ListConnectedContext(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]personStatus, 0, len(people))
+	for _, p := range people {
+		active, err := activeMatchers(devs, p)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, personStatus{Name: p.Name, Home: len(active) > 0, ActiveDevices: strings.Join(active, ",")})
+	}
+
+	return PrintRecords(os.Stdout, format, rows, []string{"Name", "Home", "Active devices"})
+}
+
+// CheckPerson reports whether any of the person's devices is active
+func CheckPerson(ctx context.Context, c router.RouterClient, p config.Person) (bool, error) {
+	devs, err := router.ListConnectedContext(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	active, err := activeMatchers(devs, p)
+	return len(active) > 0, err
+}
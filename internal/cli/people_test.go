@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// staticClient is a RouterClient returning a fixed host table
+type staticClient []router.Device
+
+func (s staticClient) ListConnected() ([]router.Device, error) {
+	return s, nil
+}
+
+func TestCheckPerson(t *testing.T) {
+	c := staticClient{
+		{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "alice-phone", Active: false},
+		{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "alice-laptop", Active: true},
+		{MAC: "AA:BB:CC:DD:EE:03", IP: "192.168.0.30", Hostname: "bob-phone", Active: false},
+	}
+
+	tests := []struct {
+		person config.Person
+		home   bool
+	}{
+		{config.Person{Name: "alice", Devices: []string{"alice-phone", "aa-bb-cc-dd-ee-02"}}, true},
+		{config.Person{Name: "bob", Devices: []string{"bob-phone", "192.168.0.99"}}, false},
+	}
+
+	for _, tt := range tests {
+		home, err := CheckPerson(context.Background(), c, tt.person)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.person.Name, err)
+		}
+		if home != tt.home {
+			t.Errorf("%s: expected home=%t, got %t", tt.person.Name, tt.home, home)
+		}
+	}
+
+	active, _ := activeMatchers(c, config.Person{Devices: []string{"alice-phone", "aa-bb-cc-dd-ee-02", "alice-laptop"}})
+	if want := []string{"aa-bb-cc-dd-ee-02", "alice-laptop"}; !reflect.DeepEqual(active, want) {
+		t.Errorf("expected active matchers %v, got %v", want, active)
+	}
+}
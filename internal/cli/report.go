@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/history"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// reportSubject is a person or device whose sessions are summarized
+type reportSubject struct {
+	name     string
+	kind     string // "person" or "device"
+	mac      string // empty for people
+	sessions []history.Interval
+}
+
+// reportRow is a display struct for the report command
+type reportRow struct {
+	Name             string
+	Kind             string
+	Days             int
+	HoursPerDay      string
+	HoursPerWeek     string
+	TypicalArrival   string
+	TypicalDeparture string
+	LongestAbsence   string
+}
+
+// reportRecord is the machine-readable form of reportRow
+type reportRecord struct {
+	Name                  string  `json:"name"`
+	Kind                  string  `json:"kind"`
+	MAC                   string  `json:"mac"`
+	Days                  int     `json:"days"`
+	HoursPerDay           float64 `json:"hours_per_day"`
+	HoursPerWeek          float64 `json:"hours_per_week"`
+	TypicalArrival        string  `json:"typical_arrival"`   // HH:MM, empty if no arrival was observed
+	TypicalDeparture      string  `json:"typical_departure"` // HH:MM, empty if no departure was observed
+	LongestAbsenceSeconds int64   `json:"longest_absence_seconds"`
+}
+
+// periodRecord is the present time of a subject in one day or week. It
+// doubles as the display struct.
+type periodRecord struct {
+	Name   string  `json:"name"`
+	Kind   string  `json:"kind"`
+	Period string  `json:"period"` // 2006-01-02 for days, 2006-W01 for weeks
+	Hours  float64 `json:"hours"`
+}
+
+// Report summarizes the presence recorded in the store within the last
+// since for every person and every device that was active at least once.
+// If subject names a person only that person is reported, otherwise it is
+// used as a device matcher. With by set, present hours are broken down per
+// day or week instead.
+func Report(store *history.Store, people []config.Person, subject string, since time.Duration, by *history.Bucket, format Format) error {
+	snaps, err := store.Load(time.Now().Add(-since))
+	if err != nil {
+		return err
+	}
+	devices := history.Devices(snaps, history.MaxGap)
+	coverage := history.Coverage(snaps, history.MaxGap)
+
+	var subjects []reportSubject
+	for _, p := range people {
+		if subject != "" && subject != p.Name {
+			continue
+		}
+		matchers, err := personMatchers(p)
+		if err != nil {
+			return err
+		}
+		var sets [][]history.Interval
+		for _, h := range devices {
+			for _, m := range matchers {
+				if m(h.Device()) {
+					sets = append(sets, h.Sessions)
+					break
+				}
+			}
+		}
+		subjects = append(subjects, reportSubject{name: p.Name, kind: "person", sessions: history.Merge(sets...)})
+	}
+	if subject == "" || len(subjects) == 0 {
+		var m router.Matcher
+		if subject != "" {
+			if m, err = router.ParseMatcher(subject); err != nil {
+				return err
+			}
+		}
+		for _, h := range devices {
+			if len(h.Sessions) == 0 || m != nil && !m(h.Device()) {
+				continue
+			}
+			name := h.Hostname
+			if name == "" {
+				name = h.MAC
+			}
+			subjects = append(subjects, reportSubject{name: name, kind: "device", mac: h.MAC, sessions: h.Sessions})
+		}
+	}
+
+	if by != nil {
+		return printBreakdown(subjects, coverage, *by, format)
+	}
+
+	records := make([]reportRecord, 0, len(subjects))
+	rows := make([]reportRow, 0, len(subjects))
+	for _, s := range subjects {
+		sum := history.Summarize(s.sessions, coverage, time.Local)
+		r := reportRecord{
+			Name:                  s.name,
+			Kind:                  s.kind,
+			MAC:                   s.mac,
+			Days:                  sum.Days,
+			HoursPerDay:           roundHours(sum.HoursPerDay),
+			HoursPerWeek:          roundHours(sum.HoursPerWeek),
+			LongestAbsenceSeconds: int64(sum.LongestAbsence.Seconds()),
+		}
+		if sum.Arrivals > 0 {
+			r.TypicalArrival = clock(sum.TypicalArrival)
+		}
+		if sum.Departures > 0 {
+			r.TypicalDeparture = clock(sum.TypicalDeparture)
+		}
+		records = append(records, r)
+		rows = append(rows, reportRow{
+			Name:             r.Name,
+			Kind:             r.Kind,
+			Days:             r.Days,
+			HoursPerDay:      fmt.Sprintf("%.1f", r.HoursPerDay),
+			HoursPerWeek:     fmt.Sprintf("%.1f", r.HoursPerWeek),
+			TypicalArrival:   orDash(r.TypicalArrival),
+			TypicalDeparture: orDash(r.TypicalDeparture),
+			LongestAbsence:   sum.LongestAbsence.Round(time.Minute).String(),
+		})
+	}
+
+	if format != FormatTable {
+		return PrintRecords(os.Stdout, format, records, nil)
+	}
+	return PrintStructTable(os.Stdout, rows, []string{"Name", "Kind", "Days", "Hours/day", "Hours/week", "Arrival", "Departure", "Longest absence"})
+}
+
+// printBreakdown prints the present hours of every subject per day or week
+func printBreakdown(subjects []reportSubject, coverage []history.Interval, by history.Bucket, format Format) error {
+	var records []periodRecord
+	for _, s := range subjects {
+		for _, p := range history.Breakdown(s.sessions, coverage, by, time.Local) {
+			period := p.Start.Format("2006-01-02")
+			if by == history.BucketWeek {
+				year, week := p.Start.ISOWeek()
+				period = fmt.Sprintf("%d-W%02d", year, week)
+			}
+			records = append(records, periodRecord{Name: s.name, Kind: s.kind, Period: period, Hours: roundHours(p.Present.Hours())})
+		}
+	}
+	if records == nil {
+		records = []periodRecord{}
+	}
+	return PrintRecords(os.Stdout, format, records, []string{"Name", "Kind", "Period", "Hours"})
+}
+
+// roundHours rounds to two decimals for stable machine-readable output
+func roundHours(h float64) float64 {
+	return math.Round(h*100) / 100
+}
+
+// clock formats an offset from midnight as HH:MM
+func clock(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%02d:%02d", int(d.Hours())%24, int(d.Minutes())%60)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
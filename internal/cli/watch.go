@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// Watch polls the router every interval and prints a line for every device
+// that joins, leaves or changes its IP address. The first successful poll
+// reports all currently active devices as joined. Polling errors are printed
+// to stderr and do not stop the watch; it runs until ctx is cancelled.
+// Clients supporting sessions stay logged in for the whole watch; a failed
+// login, e.g. while the router reboots, is retried like a failed poll.
+// Machine-readable formats emit one record per event (JSON as NDJSON).
+// Events are also passed to handlers, except for the devices reported by
+// the first poll, which were present before the watch started.
+func Watch(ctx context.Context, c router.RouterClient, interval time.Duration, format Format, handlers ...func(time.Time, router.Event)) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	s, _ := c.(router.SessionClient)
+	loggedIn := false
+	defer func() {
+		if loggedIn {
+			s.Close()
+		}
+	}()
+
+	var rw *recordWriter
+	if format != FormatTable {
+		var err error
+		rw, err = newRecordWriter(os.Stdout, format, reflect.TypeOf(eventRecord{}))
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev []router.Device
+	baseline := true
+	for {
+		var devs []router.Device
+		var err error
+		if s != nil && !loggedIn {
+			if err = login(ctx, s); err == nil {
+				loggedIn = true
+			}
+		}
+		if err == nil {
+			devs, err = router.ListConnectedContext(ctx, c)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				// interrupted while polling
+				return nil
+			}
+			fmt.Fprintln(os.Stderr, "poll failed:", err)
+		} else {
+			now := time.Now()
+			for _, e := range router.DiffDevices(prev, devs) {
+				if !baseline {
+					for _, h := range handlers {
+						h(now, e)
+					}
+				}
+				if rw == nil {
+					printEvent(os.Stdout, now, e)
+					continue
+				}
+				if err := rw.write(reflect.ValueOf(newEventRecord(now, e))); err != nil {
+					return err
+				}
+			}
+			if rw != nil {
+				if err := rw.flush(); err != nil {
+					return err
+				}
+			}
+			prev = devs
+			baseline = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// login opens the session of s, passing ctx along if s supports it
+func login(ctx context.Context, s router.SessionClient) error {
+	if lc, ok := s.(interface{ LoginContext(context.Context) error }); ok {
+		return lc.LoginContext(ctx)
+	}
+	return s.Login()
+}
+
+// printEvent writes a single timestamped event line
+func printEvent(w io.Writer, t time.Time, e router.Event) {
+	ip := e.Device.IP
+	if e.Kind == router.EventIPChanged {
+		ip = e.PrevIP + " -> " + e.Device.IP
+	}
+	fmt.Fprintf(w, "%s %-10s %s %s %s\n", t.Format(time.RFC3339), e.Kind, e.Device.MAC, ip, e.Device.Hostname)
+}
+
+// eventRecord is the machine-readable form of a watch event
+type eventRecord struct {
+	Time     string `json:"time"`
+	Event    string `json:"event"`
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	PrevIP   string `json:"prev_ip"`
+	Hostname string `json:"hostname"`
+}
+
+func newEventRecord(t time.Time, e router.Event) eventRecord {
+	return eventRecord{
+		Time:     t.Format(time.RFC3339),
+		Event:    string(e.Kind),
+		MAC:      e.Device.MAC,
+		IP:       e.Device.IP,
+		PrevIP:   e.PrevIP,
+		Hostname: e.Device.Hostname,
+	}
+}
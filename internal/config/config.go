@@ -0,0 +1,272 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Person is a named person owning one or more devices. Each device is a
+// matcher (MAC, hostname or IP) as accepted by the check command.
+type Person struct {
+	Name    string
+	Devices []string
+}
+
+// Config is the parsed config file
+type Config struct {
+	// DefaultProfile is used when no profile is selected explicitly
+	DefaultProfile string
+	Profiles       map[string]Profile
+	// People sorted by name
+	People []Person
+	// Webhooks sorted by name
+	Webhooks []Webhook
+
+	// lines maps dotted keys to the line they are defined on
+	lines map[string]int
+}
+
+// DefaultPath returns the default config file location,
+// usually ~/.config/am-i-home/config.toml
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "am-i-home", "config.toml")
+}
+
+// StateDir returns the directory for data am-i-home accumulates over time,
+// usually ~/.local/state/am-i-home ($XDG_STATE_HOME/am-i-home)
+func StateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "am-i-home")
+}
+
+// Load reads the config file at path. A missing file yields an empty config
+// unless mustExist is set (i.e. the path was given explicitly).
+func Load(path string, mustExist bool) (*Config, error) {
+	if path == "" {
+		return &Config{Profiles: map[string]Profile{}}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !mustExist {
+			return &Config{Profiles: map[string]Profile{}}, nil
+		}
+		return nil, fmt.Errorf("failed reading config: %w", err)
+	}
+	defer f.Close()
+
+	cfg, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a config file
+func Parse(r io.Reader) (*Config, error) {
+	raw, lines, err := parseTOML(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Profiles: map[string]Profile{}, lines: lines}
+	if cfg.DefaultProfile, err = getString(raw, "default_profile"); err != nil {
+		return nil, err
+	}
+
+	profiles, err := getTable(raw, "profiles")
+	if err != nil {
+		return nil, err
+	}
+	for name := range profiles {
+		t, err := getTable(profiles, name)
+		if err != nil {
+			return nil, fmt.Errorf("profiles: %w", err)
+		}
+		p, err := parseProfile(name, t)
+		if err != nil {
+			return nil, fmt.Errorf("profiles.%s: %w", name, err)
+		}
+		cfg.Profiles[name] = p
+	}
+	if cfg.DefaultProfile != "" {
+		if _, ok := cfg.Profiles[cfg.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("default_profile %q is not defined", cfg.DefaultProfile)
+		}
+	}
+
+	people, err := getTable(raw, "people")
+	if err != nil {
+		return nil, err
+	}
+	for name := range people {
+		t, err := getTable(people, name)
+		if err != nil {
+			return nil, fmt.Errorf("people: %w", err)
+		}
+		devices, err := getStrings(t, "devices")
+		if err != nil {
+			return nil, fmt.Errorf("people.%s: %w", name, err)
+		}
+		if len(devices) == 0 {
+			return nil, fmt.Errorf("people.%s: at least one device is required", name)
+		}
+		cfg.People = append(cfg.People, Person{Name: name, Devices: devices})
+	}
+	sort.Slice(cfg.People, func(i, j int) bool { return cfg.People[i].Name < cfg.People[j].Name })
+
+	webhooks, err := getTable(raw, "webhooks")
+	if err != nil {
+		return nil, err
+	}
+	for name := range webhooks {
+		t, err := getTable(webhooks, name)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks: %w", err)
+		}
+		w, err := parseWebhook(name, t)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks.%s: %w", name, err)
+		}
+		cfg.Webhooks = append(cfg.Webhooks, w)
+	}
+	sort.Slice(cfg.Webhooks, func(i, j int) bool { return cfg.Webhooks[i].Name < cfg.Webhooks[j].Name })
+
+	return cfg, nil
+}
+
+// Profile returns the named profile. An empty name selects the default
+// profile; without a default profile an empty Profile is returned.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return Profile{Retries: -1}, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// CheckMatchers validates the device matchers of people, webhooks and
+// aliases with check, e.g. router.ParseMatcher, so that a typo is reported
+// instead of never matching. People's and webhooks' devices naming an alias
+// are checked through the alias. Errors name the key and its line.
+func (c *Config) CheckMatchers(check func(expr string) error) error {
+	aliases := map[string]bool{}
+	names := make([]string, 0, len(c.Profiles))
+	for name, p := range c.Profiles {
+		names = append(names, name)
+		for alias := range p.Aliases {
+			aliases[alias] = true
+		}
+	}
+	sort.Strings(names)
+
+	checkAll := func(key string, exprs []string) error {
+		for _, expr := range exprs {
+			if aliases[expr] {
+				continue
+			}
+			if err := check(expr); err != nil {
+				return c.keyError(key, err)
+			}
+		}
+		return nil
+	}
+	for _, p := range c.People {
+		if err := checkAll("people."+p.Name+".devices", p.Devices); err != nil {
+			return err
+		}
+	}
+	for _, w := range c.Webhooks {
+		if err := checkAll("webhooks."+w.Name+".devices", w.Devices); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		p := c.Profiles[name]
+		keys := make([]string, 0, len(p.Aliases))
+		for alias := range p.Aliases {
+			keys = append(keys, alias)
+		}
+		sort.Strings(keys)
+		for _, alias := range keys {
+			if err := check(p.Aliases[alias]); err != nil {
+				return c.keyError("profiles."+name+".aliases."+alias, err)
+			}
+		}
+	}
+	return nil
+}
+
+// keyError prefixes err with key and the line it is defined on
+func (c *Config) keyError(key string, err error) error {
+	if line, ok := c.lines[key]; ok {
+		return fmt.Errorf("line %d: %s: %w", line, key, err)
+	}
+	return fmt.Errorf("%s: %w", key, err)
+}
+
+// Person looks up a person by name
+func (c *Config) Person(name string) (Person, bool) {
+	for _, p := range c.People {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Person{}, false
+}
+
+// getTable returns the sub-table at key, or nil if it is absent
+func getTable(t map[string]any, key string) (map[string]any, error) {
+	v, ok := t[key]
+	if !ok {
+		return nil, nil
+	}
+	sub, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a table", key)
+	}
+	return sub, nil
+}
+
+// getStrings returns the string array at key, or nil if it is absent
+func getStrings(t map[string]any, key string) ([]string, error) {
+	v, ok := t[key]
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", key)
+	}
+	out := make([]string, 0, len(arr))
+	for _, e := range arr {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", key)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
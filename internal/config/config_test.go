@@ -0,0 +1,383 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	in := `
+# top-level comment
+title = "am-i-home" # trailing comment
+count = 1_000
+ratio = 0.5
+enabled = true
+literal = 'C:\path'
+escaped = "a \"quoted\" #value"
+escapes = "tab\there\u00e9\U0001F600 \\"
+trailing = [1, 2,]
+empty = []
+exp = -1.5e3
+
+[section.sub]
+list = [
+  "one", # first
+  "two",
+]
+nums = [1, 2, 3]
+"quoted key" = "x"
+dotted.key = "y"
+"a\"b" = 1
+"x\"=y" = 2
+'lit\eral' = 3
+dotted.sub.key = "z"
+
+[section.sub.dotted.sub.more]
+key = "w"
+`
+	got, _, err := parseTOML(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]any{
+		"title":    "am-i-home",
+		"count":    int64(1000),
+		"ratio":    0.5,
+		"enabled":  true,
+		"literal":  `C:\path`,
+		"escaped":  `a "quoted" #value`,
+		"escapes":  "tab\there\u00e9\U0001F600 \\",
+		"trailing": []any{int64(1), int64(2)},
+		"empty":    []any{},
+		"exp":      -1500.0,
+		"section": map[string]any{
+			"sub": map[string]any{
+				"list":       []any{"one", "two"},
+				"nums":       []any{int64(1), int64(2), int64(3)},
+				"quoted key": "x",
+				"a\"b":       int64(1),
+				"x\"=y":      int64(2),
+				`lit\eral`:   int64(3),
+				"dotted": map[string]any{
+					"key": "y",
+					"sub": map[string]any{
+						"key":  "z",
+						"more": map[string]any{"key": "w"},
+					},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing value":               "a =",
+		"no assignment":               "just a line",
+		"duplicate key":               "a = 1\na = 2",
+		"unterminated array":          "a = [1,\n2",
+		"unterminated string":         `a = "abc`,
+		"array tables":                "[[people]]",
+		"key is not a table":          "a = 1\n[a.b]",
+		"invalid key":                 "a b = 1",
+		"duplicate table":             "[a]\nx = 1\n[b]\n[a]\ny = 2",
+		"infinity":                    "a = inf",
+		"Infinity":                    "a = Infinity",
+		"NaN":                         "a = nan",
+		"hex float":                   "a = 0x1p-2",
+		"leading zero":                "a = 007",
+		"octal escape":                `a = "\101"`,
+		"hex escape":                  `a = "\x41"`,
+		"single quote escape":         `a = "it\'s"`,
+		"short unicode":               `a = "\u41"`,
+		"unescaped quote":             `a = "a" "b"`,
+		"literal quote":               `a = 'a' 'b'`,
+		"text after array":            "a = [1, 2] 3",
+		"text after multi-line array": "a = [\n1,\n2] x",
+		"extra bracket":               "a = [1, 2]]",
+		"missing item":                "a = [1, , 2]",
+		"only a comma":                "a = [,]",
+		"missing comma":               "a = [1 2]",
+		"key escape":                  `"\x41" = 1`,
+		"unterminated key":            `"a\" = 1`,
+		"header after dotted keys":    "a.b.c = 1\n[a.b]",
+		"parent after dotted keys":    "a.b.c = 1\n[a]",
+		"nested header after dotted":  "[x]\na.b = 1\n[x.a]",
+		"dotted keys into header":     "[a.b]\nc = 1\n[a]\nb.d = 2",
+	}
+	for name, in := range tests {
+		if _, _, err := parseTOML(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error for %q", name, in)
+		}
+	}
+}
+
+func TestParsePeople(t *testing.T) {
+	in := `
+[people.bob]
+devices = ["bob-phone"]
+
+[people.alice]
+devices = ["aa:bb:cc:dd:ee:01", "alice-laptop"]
+`
+	cfg, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Person{
+		{Name: "alice", Devices: []string{"aa:bb:cc:dd:ee:01", "alice-laptop"}},
+		{Name: "bob", Devices: []string{"bob-phone"}},
+	}
+	if !reflect.DeepEqual(cfg.People, want) {
+		t.Errorf("got %+v, want %+v", cfg.People, want)
+	}
+
+	if p, ok := cfg.Person("bob"); !ok || p.Devices[0] != "bob-phone" {
+		t.Errorf("Person(bob) = %+v, %t", p, ok)
+	}
+	if _, ok := cfg.Person("carol"); ok {
+		t.Error("expected carol to be unknown")
+	}
+
+	if _, err := Parse(strings.NewReader("[people.carol]\ndevices = []")); err == nil {
+		t.Error("expected error for person without devices")
+	}
+	if _, err := Parse(strings.NewReader("[people.carol]\ndevices = [1]")); err == nil {
+		t.Error("expected error for non-string devices")
+	}
+}
+
+func TestCheckMatchers(t *testing.T) {
+	// stands in for router.ParseMatcher, which imports this package
+	check := func(expr string) error {
+		if strings.HasPrefix(expr, "/[") {
+			return errors.New("invalid matcher " + strconv.Quote(expr))
+		}
+		return nil
+	}
+
+	for in, want := range map[string]string{
+		"[people.alice]\ndevices = [\"alice-phone\"]\n\n[people.bob]\ndevices = [\n  \"bob-phone\",\n  \"/[a-/\",\n]\n": `line 5: people.bob.devices: invalid matcher "/[a-/"`,
+		"[profiles.home.aliases]\nphone = \"/[a-/\"\n":                                                                  `line 2: profiles.home.aliases.phone: invalid matcher "/[a-/"`,
+		"[webhooks.hook]\nurl = \"https://example.com\"\ndevices = [\"/[x\"]\n":                                         `line 3: webhooks.hook.devices: invalid matcher "/[x"`,
+		// an alias is checked through its definition
+		"[profiles.home.aliases]\nphone = \"host:phone\"\n[people.alice]\ndevices = [\"phone\"]\n": "",
+	} {
+		cfg, err := Parse(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", in, err)
+		}
+		err = cfg.CheckMatchers(check)
+		if got := fmt.Sprint(err); want == "" && err != nil || want != "" && got != want {
+			t.Errorf("%q: got %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+
+	cfg, err := Load(missing, false)
+	if err != nil {
+		t.Fatalf("expected missing default config to be ignored, got: %v", err)
+	}
+	if len(cfg.People) != 0 {
+		t.Errorf("expected empty config, got %+v", cfg)
+	}
+
+	if _, err := Load(missing, true); err == nil {
+		t.Error("expected error for missing explicit config")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte("[people.alice]\ndevices = [\"alice-phone\"]\n"), 0o600)
+	cfg, err = Load(path, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.People) != 1 {
+		t.Errorf("expected 1 person, got %+v", cfg.People)
+	}
+}
+
+func TestParseProfiles(t *testing.T) {
+	in := `
+default_profile = "home"
+
+[profiles.home]
+router = "http://192.168.0.1"
+router_type = "homestation"
+user = "admin"
+password_env = "HOME_ROUTER_PASS"
+timeout = "5s"
+table_timeout = "30s"
+retries = 4
+lockout_wait = "1m"
+output = "json"
+away_after = "3m"
+away_misses = 2
+home_hits = 1
+
+[profiles.home.aliases]
+alice = "aa:bb:cc:dd:ee:01"
+
+[profiles.parents]
+router = "https://192.168.1.1"
+password_file = "/nonexistent/password"
+tls_fingerprint = "sha256:0123"
+insecure_skip_verify = false
+`
+	cfg, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := cfg.Profile("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Profile{
+		Name:         "home",
+		Router:       "http://192.168.0.1",
+		RouterType:   "homestation",
+		User:         "admin",
+		PasswordEnv:  "HOME_ROUTER_PASS",
+		Timeout:      5 * time.Second,
+		TableTimeout: 30 * time.Second,
+		Retries:      4,
+		LockoutWait:  time.Minute,
+		Output:       "json",
+		Aliases:      map[string]string{"alice": "aa:bb:cc:dd:ee:01"},
+		AwayAfter:    3 * time.Minute,
+		AwayMisses:   2,
+		HomeHits:     1,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	if got := p.Resolve("alice"); got != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("Resolve(alice) = %q", got)
+	}
+	if got := p.Resolve("bob-phone"); got != "bob-phone" {
+		t.Errorf("Resolve(bob-phone) = %q", got)
+	}
+
+	t.Setenv("HOME_ROUTER_PASS", "secret")
+	if pass, err := p.ReadPassword(); err != nil || pass != "secret" {
+		t.Errorf("ReadPassword() = %q, %v", pass, err)
+	}
+
+	parents, err := cfg.Profile("parents")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := parents.ReadPassword(); err == nil {
+		t.Error("expected error for missing password file")
+	}
+	if parents.TLSFingerprint != "sha256:0123" || parents.InsecureSkipVerify {
+		t.Errorf("unexpected TLS settings: %+v", parents)
+	}
+	if parents.Retries != -1 {
+		t.Errorf("expected unset retries to be -1, got %d", parents.Retries)
+	}
+
+	if _, err := cfg.Profile("unknown"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":           "[profiles.home]\nrouterr = \"x\"",
+		"multiple credentials":  "[profiles.home]\npassword = \"a\"\npassword_env = \"B\"",
+		"invalid timeout":       "[profiles.home]\ntimeout = \"soon\"",
+		"invalid phase timeout": "[profiles.home]\nlogout_timeout = 5",
+		"invalid away_after":    "[profiles.home]\naway_after = \"3\"",
+		"negative away_misses":  "[profiles.home]\naway_misses = -2",
+		"insecure_skip_verify":  "[profiles.home]\ninsecure_skip_verify = \"yes\"",
+		"undefined default":     "default_profile = \"home\"",
+	}
+	for name, in := range tests {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pass")
+	os.WriteFile(path, []byte("from-file\n"), 0o600)
+
+	pass, err := Profile{PasswordFile: path}.ReadPassword()
+	if err != nil || pass != "from-file" {
+		t.Errorf("ReadPassword() = %q, %v", pass, err)
+	}
+}
+
+func TestReadPasswordCommand(t *testing.T) {
+	pass, err := Profile{PasswordCommand: "printf 'from-command\\nsecond line'"}.ReadPassword()
+	if err != nil || pass != "from-command" {
+		t.Errorf("ReadPassword() = %q, %v", pass, err)
+	}
+	if _, err := (Profile{PasswordCommand: "exit 3"}).ReadPassword(); err == nil {
+		t.Error("expected error for a failing command")
+	}
+	if _, err := (Profile{PasswordCommand: "true"}).ReadPassword(); err == nil {
+		t.Error("expected error for a command without output")
+	}
+}
+
+func TestParseWebhooks(t *testing.T) {
+	in := `
+[webhooks.phone]
+url = "https://ntfy.sh/am-i-home"
+type = "ntfy"
+events = ["joined"]
+devices = ["alice-phone"]
+
+[webhooks.automation]
+url = "https://example.com/hook"
+secret = "s3cret"
+retries = 5
+timeout = "3s"
+`
+	cfg, err := Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Webhook{
+		{Name: "automation", URL: "https://example.com/hook", Secret: "s3cret", Retries: 5, Timeout: 3 * time.Second},
+		{Name: "phone", URL: "https://ntfy.sh/am-i-home", Type: "ntfy", Events: []string{"joined"}, Devices: []string{"alice-phone"}, Retries: -1},
+	}
+	if !reflect.DeepEqual(cfg.Webhooks, want) {
+		t.Errorf("got %+v\nwant %+v", cfg.Webhooks, want)
+	}
+}
+
+func TestParseWebhookErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing url":      "[webhooks.x]\ntype = \"slack\"",
+		"unknown key":      "[webhooks.x]\nurl = \"http://x\"\nmethod = \"PUT\"",
+		"negative retries": "[webhooks.x]\nurl = \"http://x\"\nretries = -1",
+		"invalid timeout":  "[webhooks.x]\nurl = \"http://x\"\ntimeout = \"soon\"",
+	}
+	for name, in := range tests {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Profile holds the settings for one router
+type Profile struct {
+	Name       string
+	Router     string
+	RouterType string
+	User       string
+	// Credential sources, only one of them may be set
+	Password        string
+	PasswordEnv     string
+	PasswordFile    string
+	PasswordCommand string
+	Timeout         time.Duration
+	// Per-phase timeouts, zero to use Timeout
+	SaltTimeout   time.Duration
+	LoginTimeout  time.Duration
+	TableTimeout  time.Duration
+	LogoutTimeout time.Duration
+	// Retries is the number of additional attempts after a transient
+	// router error; -1 if not set
+	Retries      int
+	RetryBackoff time.Duration
+	LockoutWait  time.Duration
+	Output       string
+	// HTTPS verification, see router.TLSConfig
+	CAFile             string
+	TLSFingerprint     string
+	InsecureSkipVerify bool
+	// LinkMACs links rotated randomized MAC addresses, see history.Links
+	LinkMACs bool
+	// HistoryRetention is how long presence history is kept, e.g. "90d"
+	// (see history.ParseSince); "" keeps it forever
+	HistoryRetention string
+	// Aliases map friendly names to device matchers
+	Aliases map[string]string
+	// Debounce thresholds, see presence.Policy
+	AwayAfter  time.Duration
+	AwayMisses int
+	HomeHits   int
+	StateTTL   time.Duration
+}
+
+// profileKeys lists the keys allowed in a [profiles.NAME] table
+var profileKeys = map[string]bool{
+	"router": true, "router_type": true, "user": true, "password": true, "password_env": true,
+	"password_file": true, "password_command": true, "timeout": true, "salt_timeout": true,
+	"login_timeout": true, "table_timeout": true, "logout_timeout": true, "retries": true, "retry_backoff": true, "lockout_wait": true,
+	"ca_file": true, "tls_fingerprint": true, "insecure_skip_verify": true, "link_macs": true, "history_retention": true,
+	"output": true, "aliases": true,
+	"away_after": true, "away_misses": true, "home_hits": true, "state_ttl": true,
+}
+
+func parseProfile(name string, t map[string]any) (Profile, error) {
+	p := Profile{Name: name, Retries: -1}
+	for k := range t {
+		if !profileKeys[k] {
+			return p, fmt.Errorf("unknown key %q", k)
+		}
+	}
+
+	var err error
+	if p.Router, err = getString(t, "router"); err != nil {
+		return p, err
+	}
+	if p.RouterType, err = getString(t, "router_type"); err != nil {
+		return p, err
+	}
+	if p.User, err = getString(t, "user"); err != nil {
+		return p, err
+	}
+	if p.Password, err = getString(t, "password"); err != nil {
+		return p, err
+	}
+	if p.PasswordEnv, err = getString(t, "password_env"); err != nil {
+		return p, err
+	}
+	if p.PasswordFile, err = getString(t, "password_file"); err != nil {
+		return p, err
+	}
+	if p.PasswordCommand, err = getString(t, "password_command"); err != nil {
+		return p, err
+	}
+	if p.Output, err = getString(t, "output"); err != nil {
+		return p, err
+	}
+	if p.CAFile, err = getString(t, "ca_file"); err != nil {
+		return p, err
+	}
+	p.CAFile = expandHome(p.CAFile)
+	if p.TLSFingerprint, err = getString(t, "tls_fingerprint"); err != nil {
+		return p, err
+	}
+	if p.InsecureSkipVerify, err = getBool(t, "insecure_skip_verify"); err != nil {
+		return p, err
+	}
+	if p.LinkMACs, err = getBool(t, "link_macs"); err != nil {
+		return p, err
+	}
+	if p.HistoryRetention, err = getString(t, "history_retention"); err != nil {
+		return p, err
+	}
+
+	sources := 0
+	for _, s := range []string{p.Password, p.PasswordEnv, p.PasswordFile, p.PasswordCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return p, fmt.Errorf("only one of password, password_env, password_file and password_command may be set")
+	}
+
+	for _, d := range []struct {
+		key string
+		dst *time.Duration
+	}{
+		{"timeout", &p.Timeout},
+		{"salt_timeout", &p.SaltTimeout},
+		{"login_timeout", &p.LoginTimeout},
+		{"table_timeout", &p.TableTimeout},
+		{"logout_timeout", &p.LogoutTimeout},
+		{"retry_backoff", &p.RetryBackoff},
+		{"lockout_wait", &p.LockoutWait},
+		{"away_after", &p.AwayAfter},
+		{"state_ttl", &p.StateTTL},
+	} {
+		if *d.dst, err = getDuration(t, d.key); err != nil {
+			return p, err
+		}
+	}
+	retries, ok, err := getInt(t, "retries")
+	if err != nil {
+		return p, err
+	}
+	if ok {
+		p.Retries = retries
+	}
+	if p.AwayMisses, _, err = getInt(t, "away_misses"); err != nil {
+		return p, err
+	}
+	if p.HomeHits, _, err = getInt(t, "home_hits"); err != nil {
+		return p, err
+	}
+
+	aliases, err := getTable(t, "aliases")
+	if err != nil {
+		return p, err
+	}
+	if len(aliases) > 0 {
+		p.Aliases = make(map[string]string, len(aliases))
+		for alias := range aliases {
+			m, err := getString(aliases, alias)
+			if err != nil {
+				return p, fmt.Errorf("aliases: %w", err)
+			}
+			p.Aliases[alias] = m
+		}
+	}
+
+	return p, nil
+}
+
+// Resolve returns the matcher an alias points to, or the input unchanged
+// if it is not an alias
+func (p Profile) Resolve(matcher string) string {
+	if m, ok := p.Aliases[matcher]; ok {
+		return m
+	}
+	return matcher
+}
+
+// ReadPassword returns the password from the profile's credential source.
+// It returns "" if the profile has no credential source.
+func (p Profile) ReadPassword() (string, error) {
+	switch {
+	case p.Password != "":
+		return p.Password, nil
+
+	case p.PasswordEnv != "":
+		v := os.Getenv(p.PasswordEnv)
+		if v == "" {
+			return "", fmt.Errorf("profile %s: environment variable %s is not set", p.Name, p.PasswordEnv)
+		}
+		return v, nil
+
+	case p.PasswordFile != "":
+		v, err := ReadPasswordFile(p.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		return v, nil
+
+	case p.PasswordCommand != "":
+		v, err := RunPasswordCommand(p.PasswordCommand)
+		if err != nil {
+			return "", fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		return v, nil
+	}
+	return "", nil
+}
+
+// ReadPasswordFile returns the first line of the file at path (~/ is
+// expanded)
+func ReadPasswordFile(path string) (string, error) {
+	b, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return "", fmt.Errorf("failed reading password file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// RunPasswordCommand runs command with sh -c, e.g. "pass show router", and
+// returns the first line of its output. The command's stderr is passed
+// through so it can prompt, e.g. for a GPG passphrase.
+func RunPasswordCommand(command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("password command failed: %w", err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	line = strings.TrimRight(line, "\r")
+	if line == "" {
+		return "", fmt.Errorf("password command printed no password")
+	}
+	return line, nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// getString returns the string at key, or "" if it is absent
+func getString(t map[string]any, key string) (string, error) {
+	v, ok := t[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return s, nil
+}
+
+// getInt returns the non-negative integer at key and whether it is present
+func getInt(t map[string]any, key string) (int, bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, true, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return int(n), true, nil
+}
+
+// getBool returns the boolean at key, or false if it is absent
+func getBool(t map[string]any, key string) (bool, error) {
+	v, ok := t[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be true or false", key)
+	}
+	return b, nil
+}
+
+// getDuration returns a duration written as a string such as "10s", 0 if
+// the key is missing
+func getDuration(t map[string]any, key string) (time.Duration, error) {
+	v, err := getString(t, key)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,443 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TOML number syntax; Go's parsers also accept forms such as "Infinity",
+// "0x1p-2" or "1__0" that TOML doesn't
+var (
+	tomlInteger = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlFloat   = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+)
+
+// parseTOML parses the subset of TOML used by the config file into nested
+// maps: [table.headers], bare or quoted keys, dotted keys, strings (basic and
+// literal), integers, floats, booleans and (possibly multi-line) arrays of
+// those. Inline tables, array tables and dates are not supported. It also
+// returns the line each table header and key was defined on, keyed by its
+// dotted path such as "people.alice.devices".
+func parseTOML(r io.Reader) (map[string]any, map[string]int, error) {
+	root := map[string]any{}
+	current, currentKeys := root, []string(nil)
+	headers := map[string]bool{} // tables defined by a [header]
+	dotted := map[string]bool{}  // tables defined by dotted keys
+	lines := map[string]int{}
+
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") {
+				return nil, nil, fmt.Errorf("line %d: array tables are not supported", lineNo)
+			}
+			if !strings.HasSuffix(line, "]") {
+				return nil, nil, fmt.Errorf("line %d: unterminated table header", lineNo)
+			}
+			keys, err := splitKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			path := strings.Join(keys, "\x00")
+			if headers[path] {
+				return nil, nil, fmt.Errorf("line %d: duplicate table [%s]", lineNo, strings.Join(keys, "."))
+			}
+			if dotted[path] {
+				return nil, nil, fmt.Errorf("line %d: table [%s] is already defined by dotted keys", lineNo, strings.Join(keys, "."))
+			}
+			headers[path] = true
+			t, err := table(root, keys)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			current, currentKeys = t, keys
+			lines[strings.Join(keys, ".")] = lineNo
+			continue
+		}
+
+		rawKey, rawValue, ok := cutAssignment(line)
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		keys, err := splitKey(rawKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		keyLine := lineNo
+
+		// multi-line arrays continue until the brackets are balanced
+		for strings.HasPrefix(rawValue, "[") && !arrayClosed(rawValue) {
+			if !sc.Scan() {
+				return nil, nil, fmt.Errorf("line %d: unterminated array", lineNo)
+			}
+			lineNo++
+			rawValue += " " + strings.TrimSpace(stripComment(sc.Text()))
+		}
+
+		value, err := parseValue(rawValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		// dotted keys define tables below the current one, which neither
+		// a [header] before nor after may define again
+		for i := 1; i < len(keys); i++ {
+			path := strings.Join(append(slices.Clone(currentKeys), keys[:i]...), "\x00")
+			if headers[path] {
+				return nil, nil, fmt.Errorf("line %d: table [%s] is already defined by a header", lineNo, strings.ReplaceAll(path, "\x00", "."))
+			}
+			dotted[path] = true
+		}
+		parent, err := table(current, keys[:len(keys)-1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		last := keys[len(keys)-1]
+		if _, exists := parent[last]; exists {
+			return nil, nil, fmt.Errorf("line %d: duplicate key %q", lineNo, last)
+		}
+		parent[last] = value
+		lines[strings.Join(append(slices.Clone(currentKeys), keys...), ".")] = keyLine
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return root, lines, nil
+}
+
+// table returns the nested table at keys below t, creating it as needed
+func table(t map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		next, ok := t[k]
+		if !ok {
+			nt := map[string]any{}
+			t[k] = nt
+			t = nt
+			continue
+		}
+		nt, ok := next.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+		t = nt
+	}
+	return t, nil
+}
+
+// stripComment removes a trailing # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// cutAssignment splits a key = value line at the first = outside quotes
+func cutAssignment(line string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// splitKey splits a dotted key into its parts, unquoting quoted parts
+// (basic quoted keys may contain the escapes of basic strings)
+func splitKey(s string) ([]string, error) {
+	var keys []string
+	s = strings.TrimSpace(s)
+	for {
+		var key string
+		switch {
+		case strings.HasPrefix(s, `"`):
+			end := closingQuote(s)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key %s", s)
+			}
+			k, err := unquoteBasic(s[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key: %w", err)
+			}
+			key, s = k, s[end+1:]
+		case strings.HasPrefix(s, `'`):
+			end := strings.IndexByte(s[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key %s", s)
+			}
+			key, s = s[1:end+1], s[end+2:]
+		default:
+			end := strings.IndexByte(s, '.')
+			if end < 0 {
+				end = len(s)
+			}
+			key, s = strings.TrimSpace(s[:end]), s[end:]
+			if key == "" || strings.ContainsFunc(key, func(r rune) bool {
+				return !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			}) {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+		}
+		keys = append(keys, key)
+
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key near %q", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// closingQuote returns the index of the quote ending the basic string s
+// starts with, skipping escaped quotes, -1 if there is none
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// arrayClosed reports whether the opening bracket of s is closed, i.e.
+// whether the brackets outside strings are balanced (or there are too many
+// closing ones, which parseValue reports)
+func arrayClosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// arrayEnd returns the index of the bracket closing the one s starts
+// with, -1 if there is none
+func arrayEnd(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s[0] == '"':
+		if len(s) < 2 || s[len(s)-1] != '"' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return unquoteBasic(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' || strings.Contains(s[1:len(s)-1], "'") {
+			return nil, fmt.Errorf("invalid string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '[':
+		end := arrayEnd(s)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated array %s", s)
+		}
+		if end != len(s)-1 {
+			return nil, fmt.Errorf("unexpected %q after array", s[end+1:])
+		}
+		return parseArray(s[1:end])
+	}
+
+	clean := strings.ReplaceAll(s, "_", "")
+	if tomlInteger.MatchString(s) {
+		if i, err := strconv.ParseInt(clean, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	if tomlFloat.MatchString(s) {
+		if f, err := strconv.ParseFloat(clean, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %s", s)
+}
+
+// unquoteBasic decodes a basic string in double quotes with the escapes
+// TOML allows: \b, \t, \n, \f, \r, \", \\, \uXXXX and \UXXXXXXXX
+func unquoteBasic(s string) (string, error) {
+	var b strings.Builder
+	body := s[1 : len(s)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '"' {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		switch body[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"', '\\':
+			b.WriteByte(body[i])
+		case 'u', 'U':
+			n := 4
+			if body[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(body) {
+				return "", fmt.Errorf("invalid escape in string %s", s)
+			}
+			r, err := strconv.ParseUint(body[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", fmt.Errorf("invalid escape in string %s", s)
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in string %s", body[i], s)
+		}
+	}
+	return b.String(), nil
+}
+
+// parseArray parses the comma-separated contents of an array
+func parseArray(s string) ([]any, error) {
+	out := []any{}
+	var quote byte
+	depth := 0
+	start := 0
+	flush := func(end int, last bool) error {
+		item := strings.TrimSpace(s[start:end])
+		if item == "" {
+			// only a trailing comma (or an empty array) leaves no item
+			if last && (len(out) > 0 || start == 0) {
+				return nil
+			}
+			return fmt.Errorf("missing array item in [%s]", s)
+		}
+		v, err := parseValue(item)
+		if err != nil {
+			return err
+		}
+		out = append(out, v)
+		return nil
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			if err := flush(i, false); err != nil {
+				return nil, err
+			}
+			start = i + 1
+		}
+	}
+	if err := flush(len(s), true); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Webhook is an outbound notification target from a [webhooks.NAME] table.
+// Payload types and templates are validated by the notify package.
+type Webhook struct {
+	Name string
+	URL  string
+	// Type selects the payload: "json" (default), "ntfy", "gotify" or "slack"
+	Type string
+	// Template overrides the request body for json webhooks and the message
+	// text for all other types
+	Template string
+	// Secret enables HMAC-SHA256 signing of the request body
+	Secret string
+	// Token is the Gotify application token
+	Token string
+	// Events to send ("joined", "left", "ip-changed"), all arrivals and
+	// departures if empty
+	Events []string
+	// Devices restricts notifications to devices matching one of these
+	// matchers, all devices if empty
+	Devices []string
+	// Retries is the number of additional attempts after a failed delivery;
+	// -1 if not set
+	Retries int
+	Timeout time.Duration
+}
+
+// webhookKeys lists the keys allowed in a [webhooks.NAME] table
+var webhookKeys = map[string]bool{
+	"url": true, "type": true, "template": true, "secret": true, "token": true,
+	"events": true, "devices": true, "retries": true, "timeout": true,
+}
+
+func parseWebhook(name string, t map[string]any) (Webhook, error) {
+	w := Webhook{Name: name, Retries: -1}
+	for k := range t {
+		if !webhookKeys[k] {
+			return w, fmt.Errorf("unknown key %q", k)
+		}
+	}
+
+	var err error
+	if w.URL, err = getString(t, "url"); err != nil {
+		return w, err
+	}
+	if w.URL == "" {
+		return w, fmt.Errorf("url is required")
+	}
+	if w.Type, err = getString(t, "type"); err != nil {
+		return w, err
+	}
+	if w.Template, err = getString(t, "template"); err != nil {
+		return w, err
+	}
+	if w.Secret, err = getString(t, "secret"); err != nil {
+		return w, err
+	}
+	if w.Token, err = getString(t, "token"); err != nil {
+		return w, err
+	}
+	if w.Events, err = getStrings(t, "events"); err != nil {
+		return w, err
+	}
+	if w.Devices, err = getStrings(t, "devices"); err != nil {
+		return w, err
+	}
+
+	retries, ok, err := getInt(t, "retries")
+	if err != nil {
+		return w, err
+	}
+	if ok {
+		w.Retries = retries
+	}
+
+	timeout, err := getString(t, "timeout")
+	if err != nil {
+		return w, err
+	}
+	if timeout != "" {
+		if w.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return w, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	return w, nil
+}
@@ -0,0 +1,80 @@
+// Package credentials stores router passwords outside of plaintext files,
+// either in the desktop keyring (Secret Service) or in a file encrypted
+// with a passphrase.
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+)
+
+// ErrNotFound is returned by Store.Get if no secret is stored for a key
+var ErrNotFound = errors.New("no stored credential")
+
+// ErrNoPassphrase is returned by a File's Passphrase function (and passed
+// on by the File) if no passphrase is available, e.g. when not running
+// interactively
+var ErrNoPassphrase = errors.New("no passphrase available")
+
+// Store keeps secrets by key
+type Store interface {
+	// Name describes the store for messages, e.g. "keyring"
+	Name() string
+	Get(key string) (string, error)
+	Set(key, secret string) error
+	// Delete removes the secret for key; it returns ErrNotFound if there is none
+	Delete(key string) error
+}
+
+// Key returns the key a router password is stored under, e.g.
+// "admin@192.168.0.1". The scheme of router is ignored.
+func Key(user, router string) string {
+	if _, rest, ok := strings.Cut(router, "://"); ok {
+		router = rest
+	}
+	return user + "@" + strings.TrimSuffix(router, "/")
+}
+
+// DefaultFilePath returns the default encrypted credentials file, next to
+// the config file (usually ~/.config/am-i-home/credentials.enc)
+func DefaultFilePath() string {
+	path := config.DefaultPath()
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), "credentials.enc")
+}
+
+// Stores returns the available stores in the order they are consulted:
+// the keyring if it is available, then the encrypted file at path (if set)
+func Stores(path string, passphrase func() (string, error)) []Store {
+	var stores []Store
+	if k := NewKeyring(); k.Available() {
+		stores = append(stores, k)
+	}
+	if path != "" {
+		stores = append(stores, &File{Path: path, Passphrase: passphrase})
+	}
+	return stores
+}
+
+// Lookup returns the secret for key from the first store that has it, or
+// ErrNotFound if none does. A store that can't be unlocked for lack of a
+// passphrase is skipped like one without the key.
+func Lookup(stores []Store, key string) (string, error) {
+	for _, s := range stores {
+		secret, err := s.Get(key)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNoPassphrase) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed reading credential from %s: %w", s.Name(), err)
+		}
+		return secret, nil
+	}
+	return "", ErrNotFound
+}
@@ -0,0 +1,131 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func static(p string) func() (string, error) {
+	return func() (string, error) { return p, nil }
+}
+
+func TestKey(t *testing.T) {
+	for router, want := range map[string]string{
+		"http://192.168.0.1":  "admin@192.168.0.1",
+		"https://router.lan/": "admin@router.lan",
+		"192.168.0.1":         "admin@192.168.0.1",
+	} {
+		if got := Key("admin", router); got != want {
+			t.Errorf("Key(admin, %q) = %q, want %q", router, got, want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "credentials.enc")
+
+	f := &File{Path: path, Passphrase: static("correct horse")}
+	if _, err := f.Get("admin@router"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing file, got %v", err)
+	}
+	if err := f.Set("admin@router", "s3cret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "s3cret") {
+		t.Error("expected the secret to be encrypted")
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	f2 := &File{Path: path, Passphrase: static("correct horse")}
+	if got, err := f2.Get("admin@router"); err != nil || got != "s3cret" {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	if err := f2.Delete("admin@router"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if err := f2.Delete("admin@router"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+
+	wrong := &File{Path: path, Passphrase: static("battery staple")}
+	if _, err := wrong.Get("admin@router"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a decryption error for a wrong passphrase, got %v", err)
+	}
+}
+
+func TestFileWithoutPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	if err := (&File{Path: path, Passphrase: static("correct horse")}).Set("admin@router", "s3cret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// e.g. a cron job without AM_I_HOME_PASSPHRASE falls through to the next source
+	locked := &File{Path: path, Passphrase: func() (string, error) { return "", ErrNoPassphrase }}
+	if _, err := Lookup([]Store{locked}, "admin@router"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound without a passphrase, got %v", err)
+	}
+	if _, err := Lookup([]Store{&File{Path: path}}, "admin@router"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound without a passphrase function, got %v", err)
+	}
+}
+
+func TestFileRejectsExpensiveScryptParams(t *testing.T) {
+	for _, params := range []string{`"n": 1073741824, "r": 8, "p": 1`, `"n": 1000, "r": 8, "p": 1`, `"n": 1048576, "r": 32, "p": 1`, `"n": 32768, "r": 8, "p": 1000`, `"n": 32768, "r": 0, "p": 1`} {
+		path := filepath.Join(t.TempDir(), "credentials.enc")
+		if err := os.WriteFile(path, []byte(`{"version": 1, "kdf": "scrypt", `+params+`}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		f := &File{Path: path, Passphrase: static("correct horse")}
+		if _, err := f.Get("admin@router"); err == nil || !strings.Contains(err.Error(), "scrypt") {
+			t.Errorf("%s: expected the parameters to be rejected, got %v", params, err)
+		}
+	}
+}
+
+// TestKeyring runs the keyring against a fake secret-tool keeping secrets
+// in a directory
+func TestKeyring(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "secret-tool")
+	os.WriteFile(script, []byte(`#!/bin/sh
+store="$(dirname "$0")/$(echo "$@" | sed 's/.*account //')"
+case "$1" in
+store) cat > "$store" ;;
+lookup) [ -f "$store" ] && cat "$store" || exit 1 ;;
+clear) rm -f "$store" ;;
+esac
+`), 0o755)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path=/dev/null")
+
+	k := &Keyring{Command: script}
+	if !k.Available() {
+		t.Fatal("expected keyring to be available")
+	}
+	if _, err := k.Get("admin@router"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := k.Set("admin@router", "s3cret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// the keyring takes precedence over the file
+	file := &File{Path: filepath.Join(dir, "credentials.enc"), Passphrase: static("pw")}
+	file.Set("admin@router", "older")
+	if got, err := Lookup([]Store{k, file}, "admin@router"); err != nil || got != "s3cret" {
+		t.Errorf("Lookup() = %q, %v", got, err)
+	}
+
+	if err := k.Delete("admin@router"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if got, _ := Lookup([]Store{k, file}, "admin@router"); got != "older" {
+		t.Errorf("expected the file to be used once the keyring is empty, got %q", got)
+	}
+}
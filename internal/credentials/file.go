@@ -0,0 +1,228 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters for new files, as recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Limits on the scrypt parameters read from a file, so that a tampered
+// file can't make deriving the key take gigabytes of memory or hours
+const (
+	maxScryptN      = 1 << 20
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30 // bytes, 128*N*r
+)
+
+// fileAAD binds the ciphertext to the file format
+var fileAAD = []byte("am-i-home credentials v1")
+
+// fileEnvelope is the on-disk form of a File. The secrets are stored as a
+// JSON object encrypted with XChaCha20-Poly1305 under a key derived from
+// the passphrase with scrypt.
+type fileEnvelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// File stores secrets in a passphrase-encrypted file
+type File struct {
+	Path string
+	// Passphrase is called when the file needs to be decrypted or created
+	Passphrase func() (string, error)
+
+	passphrase string // cached after the first successful call
+}
+
+// Name implements Store
+func (f *File) Name() string {
+	return "encrypted file " + f.Path
+}
+
+// Get implements Store
+func (f *File) Get(key string) (string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := secrets[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set implements Store
+func (f *File) Set(key, secret string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[key] = secret
+	return f.save(secrets)
+}
+
+// Delete implements Store
+func (f *File) Delete(key string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return ErrNotFound
+	}
+	delete(secrets, key)
+	return f.save(secrets)
+}
+
+func (f *File) getPassphrase() (string, error) {
+	if f.passphrase != "" {
+		return f.passphrase, nil
+	}
+	if f.Passphrase == nil {
+		return "", fmt.Errorf("%w for %s", ErrNoPassphrase, f.Path)
+	}
+	p, err := f.Passphrase()
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("empty passphrase for %s", f.Path)
+	}
+	return p, nil
+}
+
+// load decrypts the file. A missing file holds no secrets and is read
+// without asking for the passphrase.
+func (f *File) load() (map[string]string, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading credentials: %w", err)
+	}
+
+	var env fileEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("failed parsing credentials %s: %w", f.Path, err)
+	}
+	if env.Version != 1 || env.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported credentials file %s (version %d, kdf %q)", f.Path, env.Version, env.KDF)
+	}
+	if err := checkScryptParams(env.N, env.R, env.P); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", f.Path, err)
+	}
+
+	passphrase, err := f.getPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), env.Salt, env.N, env.R, env.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", f.Path, err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid credentials file %s: bad nonce", f.Path)
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, fileAAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed decrypting %s: wrong passphrase or corrupted file", f.Path)
+	}
+	f.passphrase = passphrase
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed parsing credentials %s: %w", f.Path, err)
+	}
+	return secrets, nil
+}
+
+// checkScryptParams rejects scrypt parameters that are invalid or more
+// expensive than any file written by save could need
+func checkScryptParams(n, r, p int) error {
+	switch {
+	case n < 2 || n > maxScryptN || n&(n-1) != 0:
+		return fmt.Errorf("scrypt N %d is not a power of 2 up to %d", n, maxScryptN)
+	case r < 1 || r > maxScryptR:
+		return fmt.Errorf("scrypt r %d is not between 1 and %d", r, maxScryptR)
+	case p < 1 || p > maxScryptP:
+		return fmt.Errorf("scrypt p %d is not between 1 and %d", p, maxScryptP)
+	case 128*n*r > maxScryptMemory:
+		return fmt.Errorf("scrypt N %d and r %d need more than %d MiB", n, r, maxScryptMemory>>20)
+	}
+	return nil
+}
+
+// save encrypts secrets with a fresh salt and nonce and replaces the file
+// atomically
+func (f *File) save(secrets map[string]string) error {
+	passphrase, err := f.getPassphrase()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	env := fileEnvelope{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return err
+	}
+	key, err := scrypt.Key([]byte(passphrase), env.Salt, env.N, env.R, env.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Data = aead.Seal(nil, env.Nonce, plain, fileAAD)
+
+	b, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+		return fmt.Errorf("failed creating credentials directory: %w", err)
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed writing credentials: %w", err)
+	}
+	if err := os.Rename(tmp, f.Path); err != nil {
+		return fmt.Errorf("failed writing credentials: %w", err)
+	}
+	f.passphrase = passphrase
+	return nil
+}
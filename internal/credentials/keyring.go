@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// service is the Secret Service attribute identifying am-i-home secrets
+const service = "am-i-home"
+
+// Keyring stores secrets in the Secret Service (GNOME Keyring, KWallet)
+// through the secret-tool command, so secrets never appear in process
+// arguments.
+type Keyring struct {
+	// Command is the secret-tool executable
+	Command string
+}
+
+// NewKeyring returns a Keyring using secret-tool from PATH
+func NewKeyring() *Keyring {
+	return &Keyring{Command: "secret-tool"}
+}
+
+// Name implements Store
+func (k *Keyring) Name() string {
+	return "keyring"
+}
+
+// Available reports whether secret-tool is installed and a session bus to
+// reach the Secret Service is present
+func (k *Keyring) Available() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+	_, err := exec.LookPath(k.Command)
+	return err == nil
+}
+
+// Get implements Store
+func (k *Keyring) Get(key string) (string, error) {
+	out, err := k.run("", "lookup", "service", service, "account", key)
+	if err != nil {
+		// secret-tool exits with 1 and no output if nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) == 0 {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+// Set implements Store
+func (k *Keyring) Set(key, secret string) error {
+	_, err := k.run(secret, "store", "--label", "am-i-home "+key, "service", service, "account", key)
+	return err
+}
+
+// Delete implements Store
+func (k *Keyring) Delete(key string) error {
+	if _, err := k.Get(key); err != nil {
+		return err
+	}
+	_, err := k.run("", "clear", "service", service, "account", key)
+	return err
+}
+
+// run executes secret-tool with stdin and returns its output
+func (k *Keyring) run(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(k.Command, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%s %s: %w: %s", k.Command, args[0], err, msg)
+		}
+		return stdout.String(), fmt.Errorf("%s %s: %w", k.Command, args[0], err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,56 @@
+// Package filelock serializes read-modify-write cycles on state files that
+// concurrently running processes share, e.g. a watch daemon and one-shot
+// checks started from cron.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// staleAfter is how old a lock file may get before it is considered
+	// left behind by a killed process and taken over. Locks are only held
+	// while a small file is read and rewritten.
+	staleAfter = 30 * time.Second
+	// timeout is how long Lock waits for another process
+	timeout = 10 * time.Second
+	// pollInterval is how often Lock retries while the lock is held
+	pollInterval = 10 * time.Millisecond
+)
+
+// Lock acquires the lock for path by exclusively creating path.lock and
+// returns a function releasing it. It waits while another process holds
+// the lock, and takes over a lock file older than 30 seconds.
+func Lock(path string) (unlock func(), err error) {
+	lock := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lock), 0o700); err != nil {
+		return nil, fmt.Errorf("failed creating state directory: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed locking %s: %w", path, err)
+		}
+
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > staleAfter {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s, remove it if no other am-i-home is running", lock)
+		}
+		time.Sleep(pollInterval)
+	}
+}
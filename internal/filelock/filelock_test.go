@@ -0,0 +1,57 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "counter")
+
+	// without the lock concurrent increments would get lost
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := Lock(path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			b, _ := os.ReadFile(path)
+			if err := os.WriteFile(path, append(b, 'x'), 0o600); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if b, _ := os.ReadFile(path); len(b) != 20 {
+		t.Errorf("expected 20 increments, got %d", len(b))
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestLockTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path+".lock", []byte("1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,393 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+var (
+	phone  = router.Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true}
+	laptop = router.Device{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: true}
+	base   = time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+)
+
+func inactive(d router.Device) router.Device {
+	d.Active = false
+	return d
+}
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "history.jsonl")
+	s := Open(path)
+
+	s.Append(at(0), []router.Device{phone})
+	s.Append(at(1), []router.Device{phone})
+	s.Append(at(2), []router.Device{phone, laptop})
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed reading history: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	if strings.Contains(lines[1], "devices") {
+		t.Errorf("expected unchanged snapshot to be stored without devices, got %s", lines[1])
+	}
+
+	// a fresh store continues deduplicating against the file
+	s2 := Open(path)
+	s2.Append(at(3), []router.Device{phone, laptop})
+	snaps, err := s2.Load(at(1))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("expected 3 snapshots since minute 1, got %d", len(snaps))
+	}
+	if !reflect.DeepEqual(snaps[0].Devices, []router.Device{phone}) {
+		t.Errorf("expected heartbeat to repeat previous devices, got %+v", snaps[0].Devices)
+	}
+	if !reflect.DeepEqual(snaps[2].Devices, []router.Device{phone, laptop}) {
+		t.Errorf("unexpected last snapshot: %+v", snaps[2].Devices)
+	}
+	b, _ = os.ReadFile(path)
+	lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 || strings.Contains(lines[3], "devices") {
+		t.Errorf("expected deduplication across stores, got:\n%s", b)
+	}
+}
+
+func TestStoreReadsOnlyTheTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	Open(path).Append(at(0), []router.Device{phone})
+	// more unchanged polls than fit into the window read by Append
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	heartbeat := []byte(`{"time":"2026-10-01T08:01:00Z"}` + "\n")
+	for range tailWindow/len(heartbeat) + 1 {
+		f.Write(heartbeat)
+	}
+	f.Close()
+
+	s := Open(path)
+	s.Append(at(2), []router.Device{phone})
+	b, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if last := lines[len(lines)-1]; !strings.Contains(last, "devices") {
+		t.Errorf("expected the devices to be written again without them in the tail, got %s", last)
+	}
+	s.Append(at(3), []router.Device{phone})
+	b, _ = os.ReadFile(path)
+	lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	if last := lines[len(lines)-1]; strings.Contains(last, "devices") {
+		t.Errorf("expected the next poll to be deduplicated, got %s", last)
+	}
+}
+
+func TestStoresShareAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	watch, check := Open(path), Open(path)
+
+	watch.Append(at(0), []router.Device{phone})
+	check.Append(at(1), []router.Device{phone, laptop})
+	watch.Append(at(2), []router.Device{phone})
+	check.Append(at(3), []router.Device{phone})
+
+	snaps, err := Open(path).Load(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]router.Device{{phone}, {phone, laptop}, {phone}, {phone}}
+	if len(snaps) != len(want) {
+		t.Fatalf("expected %d snapshots, got %+v", len(want), snaps)
+	}
+	for i, snap := range snaps {
+		if !reflect.DeepEqual(snap.Devices, want[i]) {
+			t.Errorf("snapshot %d: got %+v, want %+v", i, snap.Devices, want[i])
+		}
+	}
+	b, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); strings.Contains(lines[3], "devices") {
+		t.Errorf("expected the last poll to be deduplicated, got:\n%s", b)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := Open(path)
+	day := 24 * 60
+	s.Append(at(0), []router.Device{phone})
+	s.Append(at(1), []router.Device{phone, laptop})
+	s.Append(at(2*day), []router.Device{phone, laptop})
+
+	// records older than the retention but within the slack are kept
+	s2 := &Store{path: path, Retention: 48 * time.Hour}
+	s2.Append(at(2*day+1), []router.Device{phone, laptop})
+	if snaps, _ := s2.Load(time.Time{}); len(snaps) != 4 {
+		t.Fatalf("expected 4 snapshots, got %d", len(snaps))
+	}
+
+	s3 := &Store{path: path, Retention: 24 * time.Hour}
+	s3.Append(at(3*day), []router.Device{phone})
+	snaps, err := s3.Load(time.Time{})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(snaps) != 3 || !snaps[0].Time.Equal(at(2*day)) {
+		t.Fatalf("expected the records of the last day, got %+v", snaps)
+	}
+	if !reflect.DeepEqual(snaps[0].Devices, []router.Device{phone, laptop}) {
+		t.Errorf("expected the first record kept to carry the devices, got %+v", snaps[0].Devices)
+	}
+	if !reflect.DeepEqual(snaps[2].Devices, []router.Device{phone}) {
+		t.Errorf("unexpected last snapshot: %+v", snaps[2].Devices)
+	}
+}
+
+func TestStoreIgnoresDetails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := Open(path)
+
+	d := phone
+	d.Signal = -60
+	s.Append(at(0), []router.Device{d})
+	d.Signal = -72
+	s.Append(at(1), []router.Device{d})
+
+	b, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || strings.Contains(lines[1], "devices") || strings.Contains(lines[0], "signal") {
+		t.Errorf("expected details not to be recorded, got:\n%s", b)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	snaps, err := Open(filepath.Join(t.TempDir(), "missing.jsonl")).Load(time.Time{})
+	if err != nil || snaps != nil {
+		t.Errorf("expected no snapshots and no error, got %v, %v", snaps, err)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	snaps := []Snapshot{
+		{Time: at(0), Devices: []router.Device{phone, inactive(laptop)}},
+		{Time: at(5), Devices: []router.Device{phone, laptop}},
+		{Time: at(10), Devices: []router.Device{inactive(phone), laptop}},
+		// gap longer than MaxGap
+		{Time: at(60), Devices: []router.Device{phone, laptop}},
+		{Time: at(65), Devices: []router.Device{phone}},
+	}
+
+	got := Devices(snaps, MaxGap)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(got))
+	}
+
+	p, l := got[0], got[1]
+	if p.Hostname != "phone" || l.Hostname != "laptop" {
+		t.Fatalf("unexpected order: %s, %s", p.Hostname, l.Hostname)
+	}
+
+	wantPhone := []Interval{
+		{Start: at(0), End: at(10)},
+		{Start: at(60), End: at(65), Open: true},
+	}
+	if !reflect.DeepEqual(p.Sessions, wantPhone) {
+		t.Errorf("phone sessions: got %+v, want %+v", p.Sessions, wantPhone)
+	}
+	if !p.FirstSeen.Equal(at(0)) || !p.LastSeen.Equal(at(65)) {
+		t.Errorf("phone first/last seen: %s, %s", p.FirstSeen, p.LastSeen)
+	}
+
+	wantLaptop := []Interval{
+		{Start: at(5), End: at(10), Interrupted: true}, // ended at its last sighting before the gap
+		{Start: at(60), End: at(65)},
+	}
+	if !reflect.DeepEqual(l.Sessions, wantLaptop) {
+		t.Errorf("laptop sessions: got %+v, want %+v", l.Sessions, wantLaptop)
+	}
+	if !l.FirstSeen.Equal(at(0)) || !l.LastSeen.Equal(at(60)) {
+		t.Errorf("laptop first/last seen: %s, %s", l.FirstSeen, l.LastSeen)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90m": 90 * time.Minute,
+		"36h": 36 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+	}
+	for in, want := range tests {
+		got, err := ParseSince(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSince(%q) = %s, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "soon"} {
+		if _, err := ParseSince(in); err == nil {
+			t.Errorf("ParseSince(%q): expected error", in)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge(
+		[]Interval{{Start: at(0), End: at(10)}, {Start: at(30), End: at(40), Interrupted: true}},
+		[]Interval{{Start: at(5), End: at(20)}, {Start: at(35), End: at(50), Open: true}},
+	)
+	want := []Interval{
+		{Start: at(0), End: at(20)},
+		{Start: at(30), End: at(50), Open: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := func(d, h, m int) time.Time {
+		return time.Date(2026, 10, 5+d, h, m, 0, 0, time.UTC)
+	}
+	coverage := []Interval{
+		{Start: day(0, 0, 0), End: day(1, 12, 0)},
+		// recording stopped for the night
+		{Start: day(2, 6, 0), End: day(2, 20, 0), Open: true},
+	}
+	sessions := []Interval{
+		{Start: day(0, 0, 0), End: day(0, 8, 0)},   // present when recording started
+		{Start: day(0, 18, 0), End: day(1, 8, 30)}, // left at 08:30
+		{Start: day(2, 6, 0), End: day(2, 7, 30)},  // present when recording resumed
+		{Start: day(2, 19, 0), End: day(2, 20, 0), Open: true},
+	}
+
+	sum := Summarize(sessions, coverage, time.UTC)
+	if sum.Days != 3 {
+		t.Errorf("expected 3 observed days, got %d", sum.Days)
+	}
+	if sum.Present != 24*time.Hour+time.Hour {
+		t.Errorf("unexpected presence: %s", sum.Present)
+	}
+	if sum.Arrivals != 2 || sum.TypicalArrival != 18*time.Hour+30*time.Minute {
+		t.Errorf("unexpected arrivals: %d, typical %s", sum.Arrivals, sum.TypicalArrival)
+	}
+	if sum.Departures != 3 || sum.TypicalDeparture != 8*time.Hour {
+		t.Errorf("unexpected departures: %d, typical %s", sum.Departures, sum.TypicalDeparture)
+	}
+	// 08:30 until the end of the first covered period at noon the next day
+	// is longer than the observed absences before
+	if sum.LongestAbsence != 11*time.Hour+30*time.Minute {
+		t.Errorf("unexpected longest absence: %s", sum.LongestAbsence)
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	coverage := []Interval{{Start: at(0), End: at(3 * 24 * 60), Open: true}}
+	sessions := []Interval{{Start: at(15 * 60), End: at(17 * 60)}} // 23:00 to 01:00
+
+	got := Breakdown(sessions, coverage, BucketDay, time.UTC)
+	if len(got) != 4 {
+		t.Fatalf("expected 4 days, got %+v", got)
+	}
+	if got[0].Present != time.Hour || got[1].Present != time.Hour || got[2].Present != 0 {
+		t.Errorf("unexpected breakdown: %+v", got)
+	}
+
+	weeks := Breakdown(sessions, coverage, BucketWeek, time.UTC)
+	if len(weeks) != 1 || weeks[0].Present != 2*time.Hour || weeks[0].Start.Weekday() != time.Monday {
+		t.Errorf("unexpected weekly breakdown: %+v", weeks)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	old := router.Device{MAC: "DA:A1:19:00:00:01", IP: "192.168.0.30", Hostname: "alice-iphone", Active: true}
+	rotated := router.Device{MAC: "DA:A1:19:00:00:02", IP: "192.168.0.31", Hostname: "alice-iphone", Active: true}
+	noName := router.Device{MAC: "6E:00:00:00:00:03", IP: "192.168.0.31", Active: true}
+	guest := router.Device{MAC: "DA:A1:19:00:00:04", IP: "192.168.0.40", Hostname: "alice-iphone", Active: true}
+	generic := router.Device{MAC: "DA:A1:19:00:00:05", IP: "192.168.0.50", Hostname: "iPhone", Active: true}
+	otherGeneric := router.Device{MAC: "DA:A1:19:00:00:06", IP: "192.168.0.50", Hostname: "iPhone", Active: true}
+
+	l := NewLinks()
+	l.Observe(at(0), []router.Device{old, phone, generic})
+	l.Observe(at(60), []router.Device{inactive(old), rotated, guest, inactive(generic)})
+	l.Observe(at(120), []router.Device{inactive(old), rotated, inactive(guest)})
+	l.Observe(at(125), []router.Device{inactive(old), inactive(rotated), inactive(guest), noName, otherGeneric})
+
+	tests := []struct {
+		mac  string
+		want []string
+	}{
+		// same hostname, never active at once
+		{old.MAC, []string{rotated.MAC, guest.MAC}},
+		// same hostname but active at the same time as rotated
+		{guest.MAC, []string{old.MAC}},
+		// taking over an IP address is no evidence
+		{noName.MAC, nil},
+		// generic hostnames are shared by unrelated devices
+		{generic.MAC, nil},
+		// vendor-assigned addresses are never linked
+		{phone.MAC, nil},
+	}
+	for _, tt := range tests {
+		if got := l.Linked(tt.mac); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Linked(%s) = %v, want %v", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestGenericHostname(t *testing.T) {
+	for h, want := range map[string]bool{
+		"": true, "*": true, "iPhone": true, "iPhone-2": true, "Galaxy-S23": true, "android-3f2a1b": true,
+		"alice-iphone": false, "Alices-iPhone": false, "DESKTOP-4K2J9QX": false, "work-laptop": false,
+	} {
+		if got := genericHostname(h); got != want {
+			t.Errorf("genericHostname(%q) = %t, want %t", h, got, want)
+		}
+	}
+}
+
+func TestLinker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s := Open(path)
+	old := router.Device{MAC: "DA:A1:19:00:00:01", IP: "192.168.0.30", Hostname: "alice-iphone", Active: true}
+	s.Append(time.Now().Add(-time.Hour), []router.Device{old})
+
+	l := &Linker{RouterClient: staticClient{{MAC: "DA:A1:19:00:00:02", Hostname: "alice-iphone", Active: true}}, Store: s}
+	devs, err := l.ListConnected()
+	if err != nil {
+		t.Fatalf("ListConnected failed: %v", err)
+	}
+	if !router.MatchDevice(devs[0], "linked:"+old.MAC) || router.MatchDevice(devs[0], old.MAC) {
+		t.Errorf("expected the rotated device to match its previous MAC with linked: only, got %+v", devs[0])
+	}
+}
+
+func TestLinkerSkipsVendorAddresses(t *testing.T) {
+	s := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	laptop := router.Device{MAC: "00:1B:63:00:00:01", Hostname: "laptop", Active: true}
+	l := &Linker{RouterClient: staticClient{laptop}, Store: s}
+	if _, err := l.ListConnected(); err != nil {
+		t.Fatalf("ListConnected failed: %v", err)
+	}
+	if l.links != nil {
+		t.Error("expected the history not to be loaded without randomized devices")
+	}
+}
+
+// staticClient is a RouterClient returning fixed devices
+type staticClient []router.Device
+
+func (c staticClient) ListConnected() ([]router.Device, error) {
+	return c, nil
+}
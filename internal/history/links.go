@@ -0,0 +1,191 @@
+package history
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/oui"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// LinkWindow is how much history the Linker considers when linking rotated
+// MAC addresses
+const LinkWindow = 30 * 24 * time.Hour
+
+// macSightings is what Links remembers about one randomized MAC address
+type macSightings struct {
+	mac       string          // as reported by the router
+	hostnames map[string]bool // distinctive hostnames only, see genericHostname
+}
+
+// genericHostnames matches default hostnames that many unrelated devices
+// share, such as "iPhone" or "Galaxy-S23", and which therefore say nothing
+// about the identity of a device
+var genericHostnames = regexp.MustCompile(`(?i)^(\*|localhost|unknown|(iphone|ipad|ipod|imac|macbook(-pro|-air)?|android|galaxy|pixel|oneplus|redmi|xiaomi|huawei|oppo|esp|espressif)([-_ ].*|[0-9].*)?)$`)
+
+// genericHostname reports whether hostname is too generic to link devices by
+func genericHostname(hostname string) bool {
+	return hostname == "" || genericHostnames.MatchString(hostname)
+}
+
+// Links correlates randomized (locally administered) MAC addresses that
+// belong to the same device. Phones rotate these addresses, so a device
+// configured by its MAC address would otherwise disappear after a rotation.
+//
+// Two randomized addresses are linked if they were never active at the same
+// time and reported the same distinctive hostname. Default hostnames such as
+// "iPhone" or "Galaxy-S23" are ignored, as are IP addresses, which DHCP
+// hands on to other devices.
+type Links struct {
+	macs     map[string]*macSightings // keyed by normalized MAC
+	together map[[2]string]bool       // pairs of normalized MACs seen active at once
+}
+
+// NewLinks returns Links without any observations
+func NewLinks() *Links {
+	return &Links{macs: map[string]*macSightings{}, together: map[[2]string]bool{}}
+}
+
+// Observe feeds a host table observed at t
+func (l *Links) Observe(t time.Time, devs []router.Device) {
+	var active []string
+	for _, d := range devs {
+		if !oui.LocallyAdministered(d.MAC) {
+			continue
+		}
+		key := router.NormalizeMAC(d.MAC)
+		s, ok := l.macs[key]
+		if !ok {
+			s = &macSightings{mac: d.MAC, hostnames: map[string]bool{}}
+			l.macs[key] = s
+		}
+		if !genericHostname(d.Hostname) {
+			s.hostnames[d.Hostname] = true
+		}
+		if d.Active {
+			active = append(active, key)
+		}
+	}
+
+	for i, a := range active {
+		for _, b := range active[i+1:] {
+			l.together[pair(a, b)] = true
+		}
+	}
+}
+
+// Linked returns the other randomized MAC addresses (sorted) that are
+// believed to belong to the same device as mac. Addresses assigned by a
+// vendor are stable and never linked.
+func (l *Links) Linked(mac string) []string {
+	key := router.NormalizeMAC(mac)
+	s, ok := l.macs[key]
+	if !ok {
+		return nil
+	}
+
+	var linked []string
+	for other, o := range l.macs {
+		if other == key || l.together[pair(key, other)] {
+			continue
+		}
+		if sharesHostname(s, o) {
+			linked = append(linked, o.mac)
+		}
+	}
+	sort.Strings(linked)
+	return linked
+}
+
+// Annotate sets LinkedMACs of the randomized devices in devs
+func (l *Links) Annotate(devs []router.Device) {
+	for i := range devs {
+		if devs[i].Randomized || oui.LocallyAdministered(devs[i].MAC) {
+			devs[i].LinkedMACs = l.Linked(devs[i].MAC)
+		}
+	}
+}
+
+func sharesHostname(a, b *macSightings) bool {
+	for h := range a.hostnames {
+		if b.hostnames[h] {
+			return true
+		}
+	}
+	return false
+}
+
+func pair(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// Linker wraps a RouterClient and sets Device.LinkedMACs of randomized
+// devices from the history in Store (limited to LinkWindow) and the host
+// tables it has seen since. The history is only loaded once a randomized
+// device shows up. Errors loading the history are passed to OnError (if
+// set) and never fail the wrapped call.
+type Linker struct {
+	router.RouterClient
+	Store   *Store
+	OnError func(error)
+
+	mu    sync.Mutex
+	links *Links
+}
+
+// ListConnected implements router.RouterClient
+func (l *Linker) ListConnected() ([]router.Device, error) {
+	return l.ListConnectedContext(context.Background())
+}
+
+// ListConnectedContext implements router.ContextClient
+func (l *Linker) ListConnectedContext(ctx context.Context) ([]router.Device, error) {
+	devs, err := router.ListConnectedContext(ctx, l.RouterClient)
+	if err != nil {
+		return devs, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.links == nil {
+		if !slices.ContainsFunc(devs, func(d router.Device) bool { return oui.LocallyAdministered(d.MAC) }) {
+			return devs, nil
+		}
+		l.links = NewLinks()
+		snaps, err := l.Store.Load(now.Add(-LinkWindow))
+		if err != nil && l.OnError != nil {
+			l.OnError(err)
+		}
+		for _, s := range snaps {
+			l.links.Observe(s.Time, s.Devices)
+		}
+	}
+	l.links.Observe(now, devs)
+	l.links.Annotate(devs)
+	return devs, nil
+}
+
+// Login forwards to the wrapped client if it supports sessions
+func (l *Linker) Login() error {
+	if s, ok := l.RouterClient.(router.SessionClient); ok {
+		return s.Login()
+	}
+	return nil
+}
+
+// Close forwards to the wrapped client if it supports sessions
+func (l *Linker) Close() error {
+	if s, ok := l.RouterClient.(router.SessionClient); ok {
+		return s.Close()
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Bucket is the calendar period present time is grouped by
+type Bucket int
+
+const (
+	// BucketDay groups by calendar day
+	BucketDay Bucket = iota
+	// BucketWeek groups by ISO week (starting on Monday)
+	BucketWeek
+)
+
+// start returns the beginning of the bucket containing t
+func (b Bucket) start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	if b == BucketWeek {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// next returns the beginning of the bucket following the one starting at start
+func (b Bucket) next(start time.Time) time.Time {
+	if b == BucketWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Coverage returns the periods in which snapshots were taken without gaps
+// longer than maxGap, i.e. the time for which presence is actually known.
+// The last period is marked Open.
+func Coverage(snaps []Snapshot, maxGap time.Duration) []Interval {
+	var out []Interval
+	for i, snap := range snaps {
+		if i == 0 || snap.Time.Sub(snaps[i-1].Time) > maxGap {
+			out = append(out, Interval{Start: snap.Time, End: snap.Time})
+			continue
+		}
+		out[len(out)-1].End = snap.Time
+	}
+	if len(out) > 0 {
+		out[len(out)-1].Open = true
+	}
+	return out
+}
+
+// Merge returns the union of several interval lists sorted by start, e.g.
+// to treat all devices of a person as one. A merged interval is open if any
+// of its parts is; it is interrupted if the part ending last is.
+func Merge(sets ...[]Interval) []Interval {
+	var all []Interval
+	for _, s := range sets {
+		all = append(all, s...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Start.Before(all[j].Start) })
+
+	var out []Interval
+	for _, iv := range all {
+		if n := len(out); n > 0 && !iv.Start.After(out[n-1].End) {
+			last := &out[n-1]
+			if iv.End.After(last.End) {
+				last.End, last.Interrupted = iv.End, iv.Interrupted
+			} else if iv.End.Equal(last.End) {
+				last.Interrupted = last.Interrupted && iv.Interrupted
+			}
+			last.Open = last.Open || iv.Open
+			continue
+		}
+		out = append(out, iv)
+	}
+	return out
+}
+
+// PeriodTotal is the time present within one calendar bucket
+type PeriodTotal struct {
+	Start   time.Time // beginning of the bucket
+	Present time.Duration
+}
+
+// Breakdown sums the present time of sessions per bucket. Every bucket
+// overlapping coverage is included, so observed days without presence are
+// reported as zero. The result is sorted by Start.
+func Breakdown(sessions, coverage []Interval, b Bucket, loc *time.Location) []PeriodTotal {
+	totals := map[time.Time]time.Duration{}
+	for _, iv := range coverage {
+		for s := b.start(iv.Start, loc); s.Before(iv.End) || s.Equal(b.start(iv.End, loc)); s = b.next(s) {
+			totals[s] += 0
+		}
+	}
+	for _, iv := range sessions {
+		for s := b.start(iv.Start, loc); s.Before(iv.End); s = b.next(s) {
+			from, to := maxTime(s, iv.Start), minTime(b.next(s), iv.End)
+			totals[s] += to.Sub(from)
+		}
+	}
+
+	out := make([]PeriodTotal, 0, len(totals))
+	for s, d := range totals {
+		out = append(out, PeriodTotal{Start: s, Present: d})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// Summary describes the presence habits of a device or person
+type Summary struct {
+	Present time.Duration // total time present
+	Days    int           // calendar days with any observation
+
+	// HoursPerDay is the average presence per observed day; HoursPerWeek
+	// extrapolates it to seven days
+	HoursPerDay  float64
+	HoursPerWeek float64
+
+	// TypicalArrival and TypicalDeparture are the median times of day
+	// (offsets from local midnight) of observed arrivals and departures.
+	// Arrivals and Departures count them; the typical time is meaningless
+	// if the count is zero.
+	TypicalArrival   time.Duration
+	Arrivals         int
+	TypicalDeparture time.Duration
+	Departures       int
+
+	// LongestAbsence is the longest observed period without presence
+	LongestAbsence time.Duration
+}
+
+// Summarize computes a Summary for sessions (as returned by Devices or
+// Merge) using coverage to tell observed changes from gaps in recording:
+// sessions starting at the beginning of a covered period and interrupted
+// sessions are not counted as arrivals or departures, and time outside
+// coverage does not count as absence.
+func Summarize(sessions, coverage []Interval, loc *time.Location) Summary {
+	var sum Summary
+	sum.Days = len(Breakdown(nil, coverage, BucketDay, loc))
+
+	coverageStart := map[time.Time]bool{}
+	for _, c := range coverage {
+		coverageStart[c.Start] = true
+	}
+
+	var arrivals, departures []time.Duration
+	for _, iv := range sessions {
+		sum.Present += iv.Duration()
+		if !coverageStart[iv.Start] {
+			arrivals = append(arrivals, timeOfDay(iv.Start, loc))
+		}
+		if !iv.Open && !iv.Interrupted {
+			departures = append(departures, timeOfDay(iv.End, loc))
+		}
+	}
+	sum.Arrivals, sum.TypicalArrival = len(arrivals), median(arrivals)
+	sum.Departures, sum.TypicalDeparture = len(departures), median(departures)
+
+	if sum.Days > 0 {
+		sum.HoursPerDay = sum.Present.Hours() / float64(sum.Days)
+		sum.HoursPerWeek = sum.HoursPerDay * 7
+	}
+
+	for _, c := range coverage {
+		cursor := c.Start
+		for _, iv := range sessions {
+			if !iv.End.After(c.Start) || !iv.Start.Before(c.End) {
+				continue
+			}
+			if gap := iv.Start.Sub(cursor); gap > sum.LongestAbsence {
+				sum.LongestAbsence = gap
+			}
+			cursor = maxTime(cursor, iv.End)
+		}
+		if gap := c.End.Sub(cursor); gap > sum.LongestAbsence {
+			sum.LongestAbsence = gap
+		}
+	}
+	return sum
+}
+
+// timeOfDay returns the offset of t from local midnight
+func timeOfDay(t time.Time, loc *time.Location) time.Duration {
+	t = t.In(loc)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// median returns the median of ds, or 0 if ds is empty
+func median(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	mid := len(ds) / 2
+	if len(ds)%2 == 0 {
+		return (ds[mid-1] + ds[mid]) / 2
+	}
+	return ds[mid]
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,338 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/filelock"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// Snapshot is the host table as observed at a point in time
+type Snapshot struct {
+	Time    time.Time
+	Devices []router.Device
+}
+
+// record is one line of the history file. Devices is omitted when the host
+// table did not change since the previous record, so polling an unchanged
+// network only appends a timestamp.
+type record struct {
+	Time    time.Time        `json:"time"`
+	Devices *[]router.Device `json:"devices,omitempty"`
+}
+
+// tailWindow is how much of the end of the file Append reads to find the
+// previous device list. Without one in that window the full list is
+// written again.
+const tailWindow = 1 << 20
+
+// pruneSlack is how much older than Retention the oldest record may get
+// before the file is rewritten, so that it is rewritten about once a day
+const pruneSlack = 24 * time.Hour
+
+// Store is an append-only JSON lines file of host table snapshots
+type Store struct {
+	path string
+	// Retention is how long records are kept, 0 to keep them forever.
+	// Older records are dropped by the first Append of a Store.
+	Retention time.Duration
+
+	mu     sync.Mutex
+	opened bool // whether the file was pruned
+}
+
+// DefaultPath returns the default history file, usually
+// ~/.local/state/am-i-home/history.jsonl. Each profile gets its own file.
+func DefaultPath(profile string) string {
+	dir := config.StateDir()
+	if dir == "" {
+		return ""
+	}
+	name := "history.jsonl"
+	if profile != "" {
+		name = "history-" + profile + ".jsonl"
+	}
+	return filepath.Join(dir, name)
+}
+
+// Open returns a Store for path. The file is created on the first Append.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Append records a snapshot
+func (s *Store) Append(t time.Time, devs []router.Device) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// other processes may be pruning the file
+	unlock, err := filelock.Lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !s.opened && s.Retention > 0 {
+		if err := s.prune(t.Add(-s.Retention)); err != nil {
+			return err
+		}
+	}
+	s.opened = true
+	// other processes may have appended since the last Append, so compare
+	// against the file rather than what this Store wrote
+	last, err := s.lastDevices()
+	if err != nil {
+		return err
+	}
+
+	// only the identity and presence are recorded, volatile details such as
+	// the signal strength would defeat the deduplication
+	devs = identities(devs)
+	rec := record{Time: t.UTC()}
+	if last == nil || !reflect.DeepEqual(last, devs) {
+		rec.Devices = &devs
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed creating history directory: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed opening history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed writing history: %w", err)
+	}
+	return nil
+}
+
+// lastDevices returns the device list of the last record carrying one,
+// reading at most tailWindow bytes from the end of the file; nil if there
+// is none in that window
+func (s *Store) lastDevices() ([]router.Device, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed reading history: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading history: %w", err)
+	}
+
+	off := max(fi.Size()-tailWindow, 0)
+	buf := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(buf, off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed reading history: %w", err)
+	}
+	lines := bytes.Split(buf, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if i == 0 && off > 0 {
+			break // cut off by the window
+		}
+		var rec record
+		if json.Unmarshal(lines[i], &rec) == nil && rec.Devices != nil {
+			return *rec.Devices, nil
+		}
+	}
+	return nil, nil
+}
+
+// prune rewrites the file without the records before cutoff, once the
+// oldest one is more than pruneSlack older. The first record kept carries
+// the full device list.
+func (s *Store) prune(cutoff time.Time) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed reading history: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var rec record
+		if json.Unmarshal(sc.Bytes(), &rec) != nil {
+			continue
+		}
+		if !rec.Time.Before(cutoff.Add(-pruneSlack)) {
+			return nil
+		}
+		break
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed reading history: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed reading history: %w", err)
+	}
+
+	tmp := fmt.Sprintf("%s.%d.tmp", s.path, os.Getpid())
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed pruning history: %w", err)
+	}
+	defer os.Remove(tmp)
+	w := bufio.NewWriter(out)
+
+	var current *[]router.Device
+	kept := false
+	sc = bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var rec record
+		if json.Unmarshal(sc.Bytes(), &rec) != nil {
+			continue
+		}
+		if rec.Devices != nil {
+			current = rec.Devices
+		}
+		if rec.Time.Before(cutoff) {
+			continue
+		}
+		if !kept {
+			rec.Devices, kept = current, true
+		}
+		line, err := json.Marshal(rec)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := sc.Err(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed reading history: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed pruning history: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed pruning history: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed pruning history: %w", err)
+	}
+	return nil
+}
+
+// Load returns all snapshots taken at or after since, oldest first.
+// A missing history file yields no snapshots.
+func (s *Store) Load(since time.Time) ([]Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(since)
+}
+
+func (s *Store) load(since time.Time) ([]Snapshot, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed reading history: %w", err)
+	}
+	defer f.Close()
+
+	var snaps []Snapshot
+	var current []router.Device
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		var rec record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			// a crash while appending may leave a truncated last line
+			continue
+		}
+		if rec.Devices != nil {
+			current = *rec.Devices
+		}
+		if current == nil || rec.Time.Before(since) {
+			continue
+		}
+		snaps = append(snaps, Snapshot{Time: rec.Time, Devices: current})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading history line %d: %w", lineNo, err)
+	}
+	return snaps, nil
+}
+
+// Recorder wraps a RouterClient and appends every successful
+// ListConnected result to a Store. Recording errors are passed to OnError
+// (if set) and never fail the wrapped call.
+type Recorder struct {
+	router.RouterClient
+	Store   *Store
+	OnError func(error)
+}
+
+// ListConnected implements router.RouterClient
+func (r *Recorder) ListConnected() ([]router.Device, error) {
+	return r.ListConnectedContext(context.Background())
+}
+
+// ListConnectedContext implements router.ContextClient
+func (r *Recorder) ListConnectedContext(ctx context.Context) ([]router.Device, error) {
+	devs, err := router.ListConnectedContext(ctx, r.RouterClient)
+	if err != nil {
+		return devs, err
+	}
+	if err := r.Store.Append(time.Now(), devs); err != nil && r.OnError != nil {
+		r.OnError(err)
+	}
+	return devs, nil
+}
+
+// Login forwards to the wrapped client if it supports sessions
+func (r *Recorder) Login() error {
+	if s, ok := r.RouterClient.(router.SessionClient); ok {
+		return s.Login()
+	}
+	return nil
+}
+
+// Close forwards to the wrapped client if it supports sessions
+func (r *Recorder) Close() error {
+	if s, ok := r.RouterClient.(router.SessionClient); ok {
+		return s.Close()
+	}
+	return nil
+}
+
+// identities returns devs with only MAC, IP, Hostname and Active set
+func identities(devs []router.Device) []router.Device {
+	out := make([]router.Device, len(devs))
+	for i, d := range devs {
+		out[i] = router.Device{MAC: d.MAC, IP: d.IP, Hostname: d.Hostname, Active: d.Active}
+	}
+	return out
+}
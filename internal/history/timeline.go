@@ -0,0 +1,134 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// MaxGap is the longest time between two snapshots that still counts as
+// continuous observation. Sessions spanning a longer gap are split, as
+// nothing is known about the device in between.
+const MaxGap = 15 * time.Minute
+
+// Interval is a period during which a device was continuously active.
+// End is the time of the first snapshot without the device (or the last
+// snapshot with it before a gap). Open intervals were still active at the
+// last snapshot; their End is the time of that snapshot. Interrupted
+// intervals were ended by a gap in recording rather than an observed
+// departure.
+type Interval struct {
+	Start       time.Time
+	End         time.Time
+	Open        bool
+	Interrupted bool
+}
+
+// Duration returns the length of the interval
+func (i Interval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+// DeviceHistory summarizes what is known about one device
+type DeviceHistory struct {
+	// latest known identity
+	MAC      string
+	IP       string
+	Hostname string
+
+	FirstSeen time.Time // first snapshot listing the device, active or not
+	LastSeen  time.Time // last snapshot in which the device was active
+	Sessions  []Interval
+}
+
+// Device returns the latest known identity as a router.Device
+func (h DeviceHistory) Device() router.Device {
+	return router.Device{MAC: h.MAC, IP: h.IP, Hostname: h.Hostname}
+}
+
+// Devices computes per-device histories from snapshots (oldest first),
+// sorted by MAC address
+func Devices(snaps []Snapshot, maxGap time.Duration) []DeviceHistory {
+	byKey := map[string]*DeviceHistory{}
+	open := map[string]*Interval{}
+	var prevTime time.Time
+
+	for i, snap := range snaps {
+		t := snap.Time
+		if i > 0 && t.Sub(prevTime) > maxGap {
+			// nothing is known about the gap, end sessions at their last sighting
+			for key, iv := range open {
+				iv.Interrupted = true
+				byKey[key].Sessions = append(byKey[key].Sessions, *iv)
+				delete(open, key)
+			}
+		}
+
+		active := map[string]bool{}
+		for _, d := range snap.Devices {
+			key := router.NormalizeMAC(d.MAC)
+			h, ok := byKey[key]
+			if !ok {
+				h = &DeviceHistory{FirstSeen: t}
+				byKey[key] = h
+			}
+			h.MAC, h.IP, h.Hostname = d.MAC, d.IP, d.Hostname
+
+			if !d.Active {
+				continue
+			}
+			active[key] = true
+			h.LastSeen = t
+			if iv, ok := open[key]; ok {
+				iv.End = t
+			} else {
+				open[key] = &Interval{Start: t, End: t}
+			}
+		}
+
+		for key, iv := range open {
+			if !active[key] {
+				iv.End = t
+				byKey[key].Sessions = append(byKey[key].Sessions, *iv)
+				delete(open, key)
+			}
+		}
+		prevTime = t
+	}
+
+	for key, iv := range open {
+		iv.Open = true
+		byKey[key].Sessions = append(byKey[key].Sessions, *iv)
+	}
+
+	out := make([]DeviceHistory, 0, len(byKey))
+	for _, h := range byKey {
+		sort.Slice(h.Sessions, func(i, j int) bool { return h.Sessions[i].Start.Before(h.Sessions[j].Start) })
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	return out
+}
+
+// ParseSince parses a look-back period such as "90m", "36h", "7d" or "2w".
+// Besides Go duration syntax it accepts whole days (d) and weeks (w).
+func ParseSince(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid period %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+	return d, nil
+}
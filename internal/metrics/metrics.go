@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// durationBuckets are the histogram upper bounds in seconds. Logins take
+// roughly a second on most HomeStations because of the double PBKDF2.
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative Prometheus-style histogram
+type histogram struct {
+	counts []uint64 // one per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, b := range durationBuckets {
+		if s <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// Collector implements router.Observer and renders everything it has seen,
+// plus the latest device snapshot, in the Prometheus text exposition format.
+type Collector struct {
+	mu            sync.Mutex
+	loginDuration *histogram
+	loginFailures map[string]uint64
+	fetchDuration *histogram
+	fetchErrors   uint64
+	devices       []router.Device
+	up            bool
+}
+
+// NewCollector creates an empty Collector
+func NewCollector() *Collector {
+	return &Collector{
+		loginDuration: newHistogram(),
+		loginFailures: map[string]uint64{},
+		fetchDuration: newHistogram(),
+	}
+}
+
+// LoginSucceeded implements router.Observer
+func (c *Collector) LoginSucceeded(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loginDuration.observe(d)
+}
+
+// LoginFailed implements router.Observer
+func (c *Collector) LoginFailed(d time.Duration, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loginDuration.observe(d)
+	c.loginFailures[reason]++
+}
+
+// HostTableFetched implements router.Observer
+func (c *Collector) HostTableFetched(d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetchDuration.observe(d)
+	if err != nil {
+		c.fetchErrors++
+	}
+}
+
+// SetDevices records the latest host table. A nil error marks the router as
+// up; on error the previous devices are kept and the router is marked down.
+func (c *Collector) SetDevices(devs []router.Device, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.up = err == nil
+	if err == nil {
+		c.devices = devs
+	}
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+
+	header(&b, "am_i_home_up", "gauge", "Whether the last host table fetch succeeded.")
+	fmt.Fprintf(&b, "am_i_home_up %d\n", boolToInt(c.up))
+
+	active := 0
+	header(&b, "am_i_home_device_active", "gauge", "Whether a device is currently active (1) or only known (0).")
+	for _, d := range c.devices {
+		if d.Active {
+			active++
+		}
+		fmt.Fprintf(&b, "am_i_home_device_active{mac=\"%s\",hostname=\"%s\",ip=\"%s\"} %d\n",
+			escape(d.MAC), escape(d.Hostname), escape(d.IP), boolToInt(d.Active))
+	}
+
+	header(&b, "am_i_home_devices_known", "gauge", "Number of devices in the router's host table.")
+	fmt.Fprintf(&b, "am_i_home_devices_known %d\n", len(c.devices))
+	header(&b, "am_i_home_devices_active", "gauge", "Number of active devices in the router's host table.")
+	fmt.Fprintf(&b, "am_i_home_devices_active %d\n", active)
+
+	header(&b, "am_i_home_login_duration_seconds", "histogram", "Duration of router login attempts.")
+	writeHistogram(&b, "am_i_home_login_duration_seconds", c.loginDuration)
+
+	header(&b, "am_i_home_login_failures_total", "counter", "Failed router logins by reason.")
+	reasons := make([]string, 0, len(c.loginFailures))
+	for r := range c.loginFailures {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(&b, "am_i_home_login_failures_total{reason=\"%s\"} %d\n", escape(r), c.loginFailures[r])
+	}
+
+	header(&b, "am_i_home_host_table_fetch_duration_seconds", "histogram", "Latency of host table fetches.")
+	writeHistogram(&b, "am_i_home_host_table_fetch_duration_seconds", c.fetchDuration)
+	header(&b, "am_i_home_host_table_fetch_errors_total", "counter", "Failed host table fetches.")
+	fmt.Fprintf(&b, "am_i_home_host_table_fetch_errors_total %d\n", c.fetchErrors)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func header(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(b *strings.Builder, name string, h *histogram) {
+	var cumulative uint64
+	for i, bound := range durationBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+// labelEscaper escapes the only characters the Prometheus text format
+// escapes in label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape prepares a label value for use between double quotes. Everything
+// but backslashes, quotes and newlines is passed through as UTF-8.
+func escape(s string) string {
+	return labelEscaper.Replace(strings.ToValidUTF8(s, "\uFFFD"))
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
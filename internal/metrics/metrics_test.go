@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	c.LoginSucceeded(300 * time.Millisecond)
+	c.LoginFailed(2*time.Second, router.LoginFailureSessionActive)
+	c.LoginFailed(2*time.Second, router.LoginFailureSessionActive)
+	c.LoginFailed(50*time.Millisecond, router.LoginFailureBadCredentials)
+	c.HostTableFetched(80*time.Millisecond, nil)
+	c.HostTableFetched(20*time.Second, errors.New("timeout"))
+	c.SetDevices([]router.Device{
+		{MAC: "aa:bb", IP: "192.168.0.10", Hostname: `we"ird\name`, Active: true},
+	}, nil)
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE am_i_home_device_active gauge\n",
+		`am_i_home_device_active{mac="aa:bb",hostname="we\"ird\\name",ip="192.168.0.10"} 1`,
+		"am_i_home_devices_active 1\n",
+		`am_i_home_login_failures_total{reason="bad_credentials"} 1`,
+		`am_i_home_login_failures_total{reason="session_active"} 2`,
+		`am_i_home_login_duration_seconds_bucket{le="0.1"} 1`,
+		`am_i_home_login_duration_seconds_bucket{le="0.5"} 2`,
+		`am_i_home_login_duration_seconds_bucket{le="2.5"} 4`,
+		`am_i_home_login_duration_seconds_bucket{le="+Inf"} 4`,
+		"am_i_home_login_duration_seconds_count 4\n",
+		`am_i_home_host_table_fetch_duration_seconds_bucket{le="10"} 1`,
+		`am_i_home_host_table_fetch_duration_seconds_bucket{le="+Inf"} 2`,
+		"am_i_home_host_table_fetch_errors_total 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestSetDevicesKeepsLastSnapshotOnError(t *testing.T) {
+	c := NewCollector()
+	c.SetDevices([]router.Device{{MAC: "aa:bb", Active: true}}, nil)
+	c.SetDevices(nil, errors.New("unreachable"))
+
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	out := buf.String()
+
+	if !strings.Contains(out, "am_i_home_up 0\n") {
+		t.Errorf("expected router to be down, got:\n%s", out)
+	}
+	if !strings.Contains(out, "am_i_home_devices_known 1\n") {
+		t.Errorf("expected previous devices to be kept, got:\n%s", out)
+	}
+}
+
+func TestLabelValuesStayUTF8(t *testing.T) {
+	c := NewCollector()
+	c.SetDevices([]router.Device{{MAC: "aa:bb", Hostname: "Jürgen’s\u00a0iPhone\tline\nbreak"}}, nil)
+
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	want := "hostname=\"Jürgen’s\u00a0iPhone\tline\\nbreak\""
+	if out := buf.String(); !strings.Contains(out, want) {
+		t.Errorf("expected output to contain %q, got:\n%s", want, out)
+	}
+}
@@ -0,0 +1,148 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"testing"
+)
+
+// testBroker is an in-process MQTT broker that accepts connections and
+// records every message it receives. Retained messages are kept per topic.
+type testBroker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	connects []connectInfo
+	messages []Message
+	retained map[string]string
+	refuse   byte // CONNACK return code
+	conns    []net.Conn
+
+	// closed receives a value whenever a client connection ends
+	closed chan struct{}
+}
+
+// connectInfo holds the interesting fields of a CONNECT packet
+type connectInfo struct {
+	clientID string
+	username string
+	password string
+	will     *Message
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed starting broker: %v", err)
+	}
+	b := &testBroker{ln: ln, retained: map[string]string{}, closed: make(chan struct{}, 16)}
+	go b.serve()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		b.closed <- struct{}{}
+	}()
+	b.mu.Lock()
+	b.conns = append(b.conns, conn)
+	b.mu.Unlock()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch header & 0xf0 {
+		case packetConnect:
+			b.mu.Lock()
+			b.connects = append(b.connects, parseConnect(body))
+			code := b.refuse
+			b.mu.Unlock()
+			writePacket(conn, packetConnack, []byte{0, code})
+			if code != 0 {
+				return
+			}
+
+		case packetPublish:
+			n := int(body[0])<<8 | int(body[1])
+			msg := Message{Topic: string(body[2 : 2+n]), Payload: body[2+n:], Retain: header&0x01 != 0}
+			b.mu.Lock()
+			b.messages = append(b.messages, msg)
+			if msg.Retain {
+				b.retained[msg.Topic] = string(msg.Payload)
+			}
+			b.mu.Unlock()
+
+		case packetPingreq:
+			writePacket(conn, packetPingresp, nil)
+
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func parseConnect(body []byte) connectInfo {
+	next := func() string {
+		n := int(body[0])<<8 | int(body[1])
+		s := string(body[2 : 2+n])
+		body = body[2+n:]
+		return s
+	}
+
+	next() // protocol name
+	flags := body[1]
+	body = body[4:]
+
+	info := connectInfo{clientID: next()}
+	if flags&0x04 != 0 {
+		info.will = &Message{Topic: next(), Payload: []byte(next()), Retain: flags&0x20 != 0}
+	}
+	if flags&0x80 != 0 {
+		info.username = next()
+	}
+	if flags&0x40 != 0 {
+		info.password = next()
+	}
+	return info
+}
+
+// drop closes all client connections, like a broker restart
+func (b *testBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *testBroker) snapshot() ([]Message, map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	retained := make(map[string]string, len(b.retained))
+	for k, v := range b.retained {
+		retained[k] = v
+	}
+	return append([]Message(nil), b.messages...), retained
+}
@@ -0,0 +1,299 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types (upper nibble of the fixed header)
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPingreq    = 0xc0
+	packetPingresp   = 0xd0
+	packetDisconnect = 0xe0
+)
+
+// Message is an MQTT application message
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configures the connection to the broker
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection drops without a DISCONNECT
+	Will *Message
+}
+
+// Client is a minimal MQTT 3.1.1 client that publishes QoS 0 messages.
+// It does not subscribe to anything; incoming packets other than
+// PINGRESP are ignored.
+type Client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	keepAlive time.Duration
+
+	mu  sync.Mutex // serializes writes
+	err error      // first read/write error, connection is unusable afterwards
+
+	done chan struct{}
+}
+
+// Dial connects to a broker. broker is either host:port or a URL of the form
+// tcp://host[:port] (port defaults to 1883).
+func Dial(broker string, opts Options) (*Client, error) {
+	addr, err := brokerAddr(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed connecting to MQTT broker: %w", err)
+	}
+
+	c := &Client{conn: conn, r: bufio.NewReader(conn), keepAlive: opts.KeepAlive, done: make(chan struct{})}
+	if err := c.connect(opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+	if c.keepAlive > 0 {
+		go c.pingLoop()
+	}
+	return c, nil
+}
+
+// brokerAddr turns a broker URL or host:port into a dialable address
+func brokerAddr(broker string) (string, error) {
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", fmt.Errorf("invalid MQTT broker %q: %w", broker, err)
+	}
+	if u.Scheme != "tcp" && u.Scheme != "mqtt" {
+		return "", fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "1883"), nil
+	}
+	return u.Host, nil
+}
+
+// connect sends CONNECT and waits for a successful CONNACK
+func (c *Client) connect(opts Options) error {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Will != nil {
+		flags |= 0x04
+		if opts.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opts.Password)
+		}
+	}
+
+	keepAlive := uint16(opts.KeepAlive / time.Second)
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	body = append(body, payload...)
+
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := writePacket(c.conn, packetConnect, body); err != nil {
+		return fmt.Errorf("failed sending CONNECT: %w", err)
+	}
+
+	typ, ack, err := readPacket(c.r)
+	if err != nil {
+		return fmt.Errorf("failed reading CONNACK: %w", err)
+	}
+	if typ&0xf0 != packetConnack || len(ack) != 2 {
+		return fmt.Errorf("unexpected packet 0x%x instead of CONNACK", typ)
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("broker refused connection: %s", connackReason(ack[1]))
+	}
+	return nil
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+// Publish sends a QoS 0 message
+func (c *Client) Publish(msg Message) error {
+	var header byte = packetPublish
+	if msg.Retain {
+		header |= 0x01
+	}
+	body := appendString(nil, msg.Topic)
+	body = append(body, msg.Payload...)
+	return c.write(header, body)
+}
+
+// Close sends DISCONNECT and closes the connection. The broker discards the
+// will message after a clean disconnect.
+func (c *Client) Close() error {
+	err := c.write(packetDisconnect, nil)
+	c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Done is closed when the connection ends, see Err for why
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that broke the connection, if any
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	if err := writePacket(c.conn, header, body); err != nil {
+		c.err = err
+		return err
+	}
+	return nil
+}
+
+// readLoop drains incoming packets (PINGRESP) until the connection closes
+func (c *Client) readLoop() {
+	defer close(c.done)
+
+	for {
+		if _, _, err := readPacket(c.r); err != nil {
+			c.mu.Lock()
+			if c.err == nil {
+				c.err = fmt.Errorf("MQTT connection lost: %w", err)
+			}
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// pingLoop keeps the connection alive while no messages are published
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.write(packetPingreq, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = append(b, byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
+
+// writePacket writes a control packet with the variable-length remaining length
+func writePacket(w io.Writer, header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		pkt = append(pkt, digit)
+		if n == 0 {
+			break
+		}
+	}
+	pkt = append(pkt, body...)
+	_, err := w.Write(pkt)
+	return err
+}
+
+// readPacket reads one control packet and returns its first header byte and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
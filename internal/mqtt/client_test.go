@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientPublish(t *testing.T) {
+	b := newTestBroker(t)
+
+	c, err := Dial(b.addr(), Options{
+		ClientID:  "am-i-home-test",
+		Username:  "user",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "am-i-home/status", Payload: []byte("offline"), Retain: true},
+	})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	if err := c.Publish(Message{Topic: "a/b", Payload: []byte("hello")}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	// payloads above 127 bytes need a multi-byte remaining length
+	long := strings.Repeat("x", 300)
+	if err := c.Publish(Message{Topic: "a/long", Payload: []byte(long), Retain: true}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	<-b.closed
+
+	b.mu.Lock()
+	connects := b.connects
+	b.mu.Unlock()
+	if len(connects) != 1 {
+		t.Fatalf("expected 1 connect, got %d", len(connects))
+	}
+	got := connects[0]
+	if got.clientID != "am-i-home-test" || got.username != "user" || got.password != "secret" {
+		t.Errorf("unexpected connect info: %+v", got)
+	}
+	if got.will == nil || got.will.Topic != "am-i-home/status" || string(got.will.Payload) != "offline" || !got.will.Retain {
+		t.Errorf("unexpected will: %+v", got.will)
+	}
+
+	messages, retained := b.snapshot()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	if messages[0].Topic != "a/b" || string(messages[0].Payload) != "hello" || messages[0].Retain {
+		t.Errorf("unexpected first message: %+v", messages[0])
+	}
+	if retained["a/long"] != long {
+		t.Errorf("expected long retained payload, got %d bytes", len(retained["a/long"]))
+	}
+}
+
+func TestClientConnectionLost(t *testing.T) {
+	b := newTestBroker(t)
+	c, err := Dial(b.addr(), Options{ClientID: "x", Will: Will("am-i-home")})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer c.Close()
+
+	b.drop()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected Done to be closed when the connection is lost")
+	}
+	if err := c.Err(); err == nil || !strings.Contains(err.Error(), "connection lost") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	b.mu.Lock()
+	will := b.connects[0].will
+	b.mu.Unlock()
+	if will == nil || will.Topic != "am-i-home/status" || string(will.Payload) != StatusOffline {
+		t.Errorf("unexpected will: %+v", will)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	b := newTestBroker(t)
+	b.refuse = 4
+
+	_, err := Dial("tcp://"+b.addr(), Options{ClientID: "x"})
+	if err == nil {
+		t.Fatal("expected error for refused connection")
+	}
+	if !strings.Contains(err.Error(), "bad user name or password") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBrokerAddr(t *testing.T) {
+	tests := map[string]string{
+		"localhost":             "localhost:1883",
+		"localhost:1884":        "localhost:1884",
+		"tcp://broker.lan":      "broker.lan:1883",
+		"mqtt://10.0.0.2:11883": "10.0.0.2:11883",
+	}
+	for in, want := range tests {
+		got, err := brokerAddr(in)
+		if err != nil {
+			t.Errorf("brokerAddr(%q) returned error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("brokerAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := brokerAddr("ssl://broker.lan"); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+}
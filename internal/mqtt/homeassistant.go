@@ -0,0 +1,189 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// Device tracker states understood by Home Assistant
+const (
+	StateHome    = "home"
+	StateNotHome = "not_home"
+)
+
+// Availability payloads published on the status topic
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+)
+
+// Publisher announces router devices to Home Assistant as device_tracker
+// entities using MQTT discovery and keeps their home/not_home state current.
+// Entities are keyed by the normalized MAC address so they keep their
+// identity when hostnames or IPs change.
+type Publisher struct {
+	client          *Client
+	discoveryPrefix string
+	baseTopic       string
+
+	announced  map[string]bool
+	states     map[string]string
+	attributes map[string]string
+}
+
+// NewPublisher creates a Publisher. discoveryPrefix is Home Assistant's
+// discovery prefix (usually "homeassistant"), baseTopic the root for state,
+// attribute and availability topics.
+func NewPublisher(c *Client, discoveryPrefix, baseTopic string) *Publisher {
+	return &Publisher{
+		client:          c,
+		discoveryPrefix: discoveryPrefix,
+		baseTopic:       baseTopic,
+		announced:       map[string]bool{},
+		states:          map[string]string{},
+		attributes:      map[string]string{},
+	}
+}
+
+// StatusTopic is the availability topic shared by all entities
+func (p *Publisher) StatusTopic() string {
+	return statusTopic(p.baseTopic)
+}
+
+func statusTopic(baseTopic string) string {
+	return baseTopic + "/status"
+}
+
+// Will returns the will message to pass to Dial for a Publisher with
+// baseTopic, marking all entities unavailable when the connection breaks
+func Will(baseTopic string) *Message {
+	return &Message{Topic: statusTopic(baseTopic), Payload: []byte(StatusOffline), Retain: true}
+}
+
+// Done is closed when the broker connection ends
+func (p *Publisher) Done() <-chan struct{} {
+	return p.client.Done()
+}
+
+// Err returns the error that broke the broker connection, if any
+func (p *Publisher) Err() error {
+	return p.client.Err()
+}
+
+// SetStatus publishes the availability of all entities
+func (p *Publisher) SetStatus(status string) error {
+	return p.client.Publish(Message{Topic: p.StatusTopic(), Payload: []byte(status), Retain: true})
+}
+
+// discoveryConfig is the payload of a device_tracker discovery message
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	JSONAttributesTopic string          `json:"json_attributes_topic"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	PayloadHome         string          `json:"payload_home"`
+	PayloadNotHome      string          `json:"payload_not_home"`
+	SourceType          string          `json:"source_type"`
+	Device              discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers []string    `json:"identifiers"`
+	Connections [][2]string `json:"connections"`
+	Name        string      `json:"name"`
+}
+
+// Publish announces new devices and publishes state and attribute changes.
+// Devices that were seen before but are missing from devs are reported as
+// not_home. Unchanged states are not re-published.
+func (p *Publisher) Publish(devs []router.Device) error {
+	seen := make(map[string]bool, len(devs))
+	for _, d := range devs {
+		id := router.NormalizeMAC(d.MAC)
+		if id == "" {
+			continue
+		}
+		seen[id] = true
+
+		if !p.announced[id] {
+			if err := p.announce(id, d); err != nil {
+				return err
+			}
+			p.announced[id] = true
+		}
+
+		attrs, _ := json.Marshal(map[string]string{"mac": d.MAC, "ip": d.IP, "hostname": d.Hostname})
+		if p.attributes[id] != string(attrs) {
+			if err := p.client.Publish(Message{Topic: p.topic(id, "attributes"), Payload: attrs, Retain: true}); err != nil {
+				return err
+			}
+			p.attributes[id] = string(attrs)
+		}
+
+		state := StateNotHome
+		if d.Active {
+			state = StateHome
+		}
+		if err := p.setState(id, state); err != nil {
+			return err
+		}
+	}
+
+	for id := range p.announced {
+		if !seen[id] {
+			if err := p.setState(id, StateNotHome); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) announce(id string, d router.Device) error {
+	name := d.Hostname
+	if name == "" {
+		name = d.MAC
+	}
+	uniqueID := "am_i_home_" + id
+
+	cfg := discoveryConfig{
+		Name:                name,
+		UniqueID:            uniqueID,
+		StateTopic:          p.topic(id, "state"),
+		JSONAttributesTopic: p.topic(id, "attributes"),
+		AvailabilityTopic:   p.StatusTopic(),
+		PayloadHome:         StateHome,
+		PayloadNotHome:      StateNotHome,
+		SourceType:          "router",
+		Device: discoveryDevice{
+			Identifiers: []string{uniqueID},
+			Connections: [][2]string{{"mac", d.MAC}},
+			Name:        name,
+		},
+	}
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	topic := fmt.Sprintf("%s/device_tracker/%s/config", p.discoveryPrefix, uniqueID)
+	return p.client.Publish(Message{Topic: topic, Payload: payload, Retain: true})
+}
+
+func (p *Publisher) setState(id, state string) error {
+	if p.states[id] == state {
+		return nil
+	}
+	if err := p.client.Publish(Message{Topic: p.topic(id, "state"), Payload: []byte(state), Retain: true}); err != nil {
+		return err
+	}
+	p.states[id] = state
+	return nil
+}
+
+func (p *Publisher) topic(id, leaf string) string {
+	return p.baseTopic + "/" + id + "/" + leaf
+}
@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+func TestPublisher(t *testing.T) {
+	b := newTestBroker(t)
+	c, err := Dial(b.addr(), Options{ClientID: "am-i-home"})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	p := NewPublisher(c, "homeassistant", "am-i-home")
+	phone := router.Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true}
+	laptop := router.Device{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: false}
+
+	if err := p.SetStatus(StatusOnline); err != nil {
+		t.Fatalf("SetStatus failed: %v", err)
+	}
+	if err := p.Publish([]router.Device{phone, laptop}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	// unchanged snapshot must not publish anything
+	if err := p.Publish([]router.Device{phone, laptop}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	// phone disappears from the host table
+	if err := p.Publish([]router.Device{laptop}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	c.Close()
+	<-b.closed
+
+	messages, retained := b.snapshot()
+
+	// status + 2x (config, attributes, state) + phone not_home
+	if len(messages) != 8 {
+		t.Errorf("expected 8 messages, got %d: %+v", len(messages), messages)
+	}
+	for _, m := range messages {
+		if !m.Retain {
+			t.Errorf("expected all messages to be retained, %s was not", m.Topic)
+		}
+	}
+
+	if retained["am-i-home/status"] != StatusOnline {
+		t.Errorf("expected status online, got %q", retained["am-i-home/status"])
+	}
+	if got := retained["am-i-home/aabbccddee01/state"]; got != StateNotHome {
+		t.Errorf("expected phone to be not_home, got %q", got)
+	}
+	if got := retained["am-i-home/aabbccddee02/state"]; got != StateNotHome {
+		t.Errorf("expected laptop to be not_home, got %q", got)
+	}
+
+	var cfg discoveryConfig
+	raw, ok := retained["homeassistant/device_tracker/am_i_home_aabbccddee01/config"]
+	if !ok {
+		t.Fatal("expected discovery config for phone")
+	}
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("invalid discovery config: %v", err)
+	}
+	if cfg.UniqueID != "am_i_home_aabbccddee01" || cfg.Name != "phone" || cfg.StateTopic != "am-i-home/aabbccddee01/state" {
+		t.Errorf("unexpected discovery config: %+v", cfg)
+	}
+	if cfg.AvailabilityTopic != "am-i-home/status" || cfg.SourceType != "router" {
+		t.Errorf("unexpected discovery config: %+v", cfg)
+	}
+
+	var attrs map[string]string
+	if err := json.Unmarshal([]byte(retained["am-i-home/aabbccddee01/attributes"]), &attrs); err != nil {
+		t.Fatalf("invalid attributes: %v", err)
+	}
+	if attrs["ip"] != "192.168.0.10" {
+		t.Errorf("unexpected attributes: %+v", attrs)
+	}
+}
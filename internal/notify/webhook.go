@@ -0,0 +1,449 @@
+// Package notify delivers presence events to webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// Webhook payload types
+const (
+	// TypeJSON posts the event (or the rendered template) as JSON
+	TypeJSON = "json"
+	// TypeNtfy posts the message as plain text to an ntfy topic URL
+	TypeNtfy = "ntfy"
+	// TypeGotify posts a message to a Gotify server's /message endpoint
+	TypeGotify = "gotify"
+	// TypeSlack posts a Slack-compatible incoming webhook payload
+	TypeSlack = "slack"
+)
+
+// SignatureHeader carries "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the request body for webhooks with a secret
+const SignatureHeader = "X-Am-I-Home-Signature"
+
+// Defaults for Webhook fields that are not set
+const (
+	DefaultRetries = 3
+	DefaultTimeout = 10 * time.Second
+)
+
+// queueSize is the number of events buffered per webhook
+const queueSize = 64
+
+// maxBackoff caps the wait between delivery attempts
+const maxBackoff = 30 * time.Second
+
+// Webhook describes a notification target
+type Webhook struct {
+	Name string
+	URL  string
+	// Type is one of the Type constants, TypeJSON if empty
+	Type string
+	// Template is a text/template executed with the Event. It replaces the
+	// request body for TypeJSON and the message text for all other types.
+	Template string
+	// Secret enables request signing (see SignatureHeader)
+	Secret string
+	// Token authenticates Gotify requests
+	Token string
+	// Events to deliver, joined and left if empty
+	Events []router.EventKind
+	// Devices restricts delivery to devices matching one of these
+	// matchers, all devices if empty
+	Devices []string
+	// Retries is the number of additional attempts after a failed
+	// delivery, DefaultRetries if negative
+	Retries int
+	// Timeout per attempt, DefaultTimeout if zero
+	Timeout time.Duration
+}
+
+// Event is sent as the body of TypeJSON webhooks without a template and is
+// the data passed to templates
+type Event struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	MAC      string    `json:"mac"`
+	IP       string    `json:"ip"`
+	PrevIP   string    `json:"prev_ip"`
+	Hostname string    `json:"hostname"`
+	// Name is the hostname, or the MAC address for devices without one
+	Name string `json:"name"`
+}
+
+// NewEvent converts a router event observed at t
+func NewEvent(t time.Time, e router.Event) Event {
+	name := e.Device.Hostname
+	if name == "" {
+		name = e.Device.MAC
+	}
+	return Event{
+		Time:     t.UTC().Truncate(time.Second),
+		Event:    string(e.Kind),
+		MAC:      e.Device.MAC,
+		IP:       e.Device.IP,
+		PrevIP:   e.PrevIP,
+		Hostname: e.Device.Hostname,
+		Name:     name,
+	}
+}
+
+// Message returns a short human-readable description of the event
+func (e Event) Message() string {
+	switch router.EventKind(e.Event) {
+	case router.EventJoined:
+		return fmt.Sprintf("%s joined (%s)", e.Name, e.IP)
+	case router.EventLeft:
+		return fmt.Sprintf("%s left", e.Name)
+	case router.EventIPChanged:
+		return fmt.Sprintf("%s changed IP from %s to %s", e.Name, e.PrevIP, e.IP)
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Event)
+}
+
+// Notifier delivers events to webhooks. Every webhook has its own queue
+// and delivers events in order; failed deliveries are retried with
+// exponential backoff and jitter (see router.RetryPolicy).
+type Notifier struct {
+	client  *http.Client
+	backoff time.Duration
+	onError func(error)
+
+	hooks []*hook
+	wg    sync.WaitGroup
+}
+
+// hook is a validated Webhook with its delivery queue
+type hook struct {
+	Webhook
+	tmpl   *template.Template
+	events map[router.EventKind]bool
+	queue  chan Event
+}
+
+// Option configures optional Notifier behaviour
+type Option func(*Notifier)
+
+// WithHTTPClient sets the client used for deliveries
+func WithHTTPClient(c *http.Client) Option {
+	return func(n *Notifier) {
+		n.client = c
+	}
+}
+
+// WithBackoff sets the delay before the first retry (default 1s). It
+// doubles with every further attempt up to 30s and varies by ±20%.
+func WithBackoff(d time.Duration) Option {
+	return func(n *Notifier) {
+		n.backoff = d
+	}
+}
+
+// WithErrorHandler receives deliveries that failed for good
+func WithErrorHandler(f func(error)) Option {
+	return func(n *Notifier) {
+		n.onError = f
+	}
+}
+
+// New validates the webhooks and starts delivering. Call Close when done.
+func New(webhooks []Webhook, opts ...Option) (*Notifier, error) {
+	n := &Notifier{client: http.DefaultClient, backoff: time.Second, onError: func(error) {}}
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	for _, w := range webhooks {
+		h, err := newHook(w)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: %w", w.Name, err)
+		}
+		n.hooks = append(n.hooks, h)
+	}
+
+	for _, h := range n.hooks {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			for ev := range h.queue {
+				if err := n.deliver(h, ev); err != nil {
+					n.onError(fmt.Errorf("webhook %s: %w", h.Name, err))
+				}
+			}
+		}()
+	}
+	return n, nil
+}
+
+func newHook(w Webhook) (*hook, error) {
+	switch w.Type {
+	case "":
+		w.Type = TypeJSON
+	case TypeJSON, TypeNtfy, TypeSlack:
+	case TypeGotify:
+		if w.Token == "" {
+			return nil, errors.New("gotify requires a token")
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", w.Type)
+	}
+	if w.Retries < 0 {
+		w.Retries = DefaultRetries
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = DefaultTimeout
+	}
+
+	h := &hook{Webhook: w, events: map[router.EventKind]bool{}, queue: make(chan Event, queueSize)}
+
+	events := w.Events
+	if len(events) == 0 {
+		events = []router.EventKind{router.EventJoined, router.EventLeft}
+	}
+	for _, e := range events {
+		switch e {
+		case router.EventJoined, router.EventLeft, router.EventIPChanged:
+			h.events[e] = true
+		default:
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+	}
+
+	if w.Template != "" {
+		tmpl, err := template.New(w.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(w.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		h.tmpl = tmpl
+		if w.Type == TypeJSON {
+			if err := h.checkJSON(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h, nil
+}
+
+// checkJSON renders the template of a TypeJSON webhook for every event it
+// subscribes to and reports whether the result is valid JSON. The sample
+// hostname needs escaping, as real ones may.
+func (h *hook) checkJSON() error {
+	sample := router.Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: `Bob's "new" phone\1`, Active: true}
+	for kind := range h.events {
+		var buf bytes.Buffer
+		if err := h.tmpl.Execute(&buf, NewEvent(time.Now(), router.Event{Kind: kind, Device: sample, PrevIP: "192.168.0.9"})); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return fmt.Errorf("template renders invalid JSON for %s events, e.g. %s (embed strings with {{json .Name}})", kind, strings.TrimSpace(buf.String()))
+		}
+	}
+	return nil
+}
+
+// Validate checks webhooks the way New does without starting to deliver,
+// e.g. to report configuration errors before they are needed
+func Validate(webhooks []Webhook) error {
+	for _, w := range webhooks {
+		if _, err := newHook(w); err != nil {
+			return fmt.Errorf("webhook %s: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// toJSON is the template function "json", useful to embed strings in JSON
+// templates with proper escaping
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Notify queues an event observed at t for every webhook interested in it.
+// It never blocks; events for webhooks with a full queue are dropped and
+// reported to the error handler.
+func (n *Notifier) Notify(t time.Time, e router.Event) {
+	ev := NewEvent(t, e)
+	for _, h := range n.hooks {
+		if !h.wants(e) {
+			continue
+		}
+		select {
+		case h.queue <- ev:
+		default:
+			n.onError(fmt.Errorf("webhook %s: queue full, dropping %s event for %s", h.Name, ev.Event, ev.Name))
+		}
+	}
+}
+
+// Close delivers all queued events and stops the Notifier
+func (n *Notifier) Close() {
+	for _, h := range n.hooks {
+		close(h.queue)
+	}
+	n.wg.Wait()
+}
+
+// wants reports whether the webhook subscribes to the event
+func (h *hook) wants(e router.Event) bool {
+	if !h.events[e.Kind] {
+		return false
+	}
+	if len(h.Devices) == 0 {
+		return true
+	}
+	for _, m := range h.Devices {
+		if router.MatchDevice(e.Device, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// permanentError is a delivery failure that retrying will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// deliver sends ev, retrying transient failures according to the webhook's
+// retry policy
+func (n *Notifier) deliver(h *hook, ev Event) error {
+	req, err := h.request(ev)
+	if err != nil {
+		return err
+	}
+
+	policy := router.RetryPolicy{
+		MaxAttempts:    h.Retries + 1,
+		InitialBackoff: n.backoff,
+		MaxBackoff:     maxBackoff,
+		Jitter:         router.DefaultRetryPolicy.Jitter,
+		Retryable: func(err error) bool {
+			var perm *permanentError
+			return !errors.As(err, &perm)
+		},
+	}
+	attempts := 0
+	err = policy.Do(context.Background(), nil, "webhook "+h.Name, func() error {
+		attempts++
+		return n.post(h, req)
+	})
+	var perm *permanentError
+	if err != nil && !errors.As(err, &perm) {
+		return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+	}
+	return err
+}
+
+// request is a rendered webhook request, ready to be sent (repeatedly)
+type request struct {
+	url    string
+	body   []byte
+	header http.Header
+}
+
+// request renders the payload for the webhook's type
+func (h *hook) request(ev Event) (request, error) {
+	r := request{url: h.URL, header: http.Header{}}
+
+	text := ev.Message()
+	if h.tmpl != nil {
+		var buf bytes.Buffer
+		if err := h.tmpl.Execute(&buf, ev); err != nil {
+			return r, &permanentError{fmt.Errorf("failed rendering template: %w", err)}
+		}
+		text = buf.String()
+	}
+
+	var err error
+	switch h.Type {
+	case TypeJSON:
+		r.header.Set("Content-Type", "application/json")
+		if h.tmpl != nil {
+			r.body = []byte(text)
+		} else {
+			r.body, err = json.Marshal(ev)
+		}
+
+	case TypeNtfy:
+		r.header.Set("Content-Type", "text/plain; charset=utf-8")
+		r.header.Set("Title", "am-i-home")
+		tag := "house"
+		if ev.Event == string(router.EventLeft) {
+			tag = "wave"
+		}
+		r.header.Set("Tags", tag)
+		r.body = []byte(text)
+
+	case TypeGotify:
+		r.header.Set("Content-Type", "application/json")
+		r.header.Set("X-Gotify-Key", h.Token)
+		if !strings.HasSuffix(r.url, "/message") {
+			r.url = strings.TrimRight(r.url, "/") + "/message"
+		}
+		r.body, err = json.Marshal(map[string]any{"title": "am-i-home", "message": text, "priority": 5})
+
+	case TypeSlack:
+		r.header.Set("Content-Type", "application/json")
+		r.body, err = json.Marshal(map[string]string{"text": text})
+	}
+	if err != nil {
+		return r, &permanentError{err}
+	}
+
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(r.body)
+		r.header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return r, nil
+}
+
+// post makes a single delivery attempt. Client errors other than 429 are
+// permanent; network errors, 429 and server errors may be retried.
+func (n *Notifier) post(h *hook, r request) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(r.body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", "am-i-home")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return &permanentError{fmt.Errorf("unexpected status %s", resp.Status)}
+}
@@ -0,0 +1,207 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+var (
+	phone  = router.Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true}
+	laptop = router.Device{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: true}
+	now    = time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+)
+
+// received is a request captured by the test endpoint
+type received struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// endpoint records requests and answers them with the queued status codes
+// (200 once they are used up)
+type endpoint struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+func newEndpoint(t *testing.T, statuses ...int) *endpoint {
+	e := &endpoint{statuses: statuses}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.requests = append(e.requests, received{path: r.URL.Path, header: r.Header, body: string(body)})
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *endpoint) received() []received {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]received(nil), e.requests...)
+}
+
+// notifyAll sends events through a new Notifier and waits for delivery
+func notifyAll(t *testing.T, hooks []Webhook, events ...router.Event) []error {
+	var mu sync.Mutex
+	var errs []error
+	n, err := New(hooks, WithBackoff(time.Millisecond), WithErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, e := range events {
+		n.Notify(now, e)
+	}
+	n.Close()
+	return errs
+}
+
+func TestJSONWebhook(t *testing.T) {
+	ep := newEndpoint(t)
+	errs := notifyAll(t, []Webhook{{Name: "hook", URL: ep.URL, Secret: "s3cret", Retries: -1}},
+		router.Event{Kind: router.EventJoined, Device: phone},
+		router.Event{Kind: router.EventIPChanged, Device: phone, PrevIP: "192.168.0.9"}, // not subscribed by default
+		router.Event{Kind: router.EventLeft, Device: laptop},
+	)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	reqs := ep.received()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+
+	var ev Event
+	if err := json.Unmarshal([]byte(reqs[0].body), &ev); err != nil {
+		t.Fatalf("invalid body %s: %v", reqs[0].body, err)
+	}
+	want := Event{Time: now, Event: "joined", MAC: phone.MAC, IP: phone.IP, Hostname: "phone", Name: "phone"}
+	if ev != want {
+		t.Errorf("got %+v, want %+v", ev, want)
+	}
+	if !strings.Contains(reqs[1].body, `"event":"left"`) {
+		t.Errorf("expected left event second, got %s", reqs[1].body)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(reqs[0].body))
+	if got, want := reqs[0].header.Get(SignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature: got %q, want %q", got, want)
+	}
+}
+
+func TestTemplateAndFilters(t *testing.T) {
+	ep := newEndpoint(t)
+	hook := Webhook{
+		Name:     "hook",
+		URL:      ep.URL,
+		Template: `{"who": {{json .Name}}, "what": "{{.Event}}"}`,
+		Events:   []router.EventKind{router.EventLeft},
+		Devices:  []string{"laptop"},
+	}
+	notifyAll(t, []Webhook{hook},
+		router.Event{Kind: router.EventLeft, Device: phone},
+		router.Event{Kind: router.EventJoined, Device: laptop},
+		router.Event{Kind: router.EventLeft, Device: laptop},
+	)
+
+	reqs := ep.received()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if want := `{"who": "laptop", "what": "left"}`; reqs[0].body != want {
+		t.Errorf("got %s, want %s", reqs[0].body, want)
+	}
+	if reqs[0].header.Get(SignatureHeader) != "" {
+		t.Error("expected no signature without a secret")
+	}
+}
+
+func TestPayloadTypes(t *testing.T) {
+	ep := newEndpoint(t)
+	notifyAll(t, []Webhook{
+		{Name: "gotify", Type: TypeGotify, URL: ep.URL, Token: "tok"},
+		{Name: "ntfy", Type: TypeNtfy, URL: ep.URL + "/am-i-home"},
+		{Name: "slack", Type: TypeSlack, URL: ep.URL + "/services/x"},
+	}, router.Event{Kind: router.EventLeft, Device: phone})
+
+	byPath := map[string]received{}
+	for _, r := range ep.received() {
+		byPath[r.path] = r
+	}
+
+	gotify := byPath["/message"]
+	if gotify.header.Get("X-Gotify-Key") != "tok" || !strings.Contains(gotify.body, `"message":"phone left"`) {
+		t.Errorf("unexpected gotify request: %+v", gotify)
+	}
+	ntfy := byPath["/am-i-home"]
+	if ntfy.body != "phone left" || ntfy.header.Get("Tags") != "wave" {
+		t.Errorf("unexpected ntfy request: %+v", ntfy)
+	}
+	if slack := byPath["/services/x"]; slack.body != `{"text":"phone left"}` {
+		t.Errorf("unexpected slack request: %+v", slack)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ep := newEndpoint(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	errs := notifyAll(t, []Webhook{{Name: "hook", URL: ep.URL, Retries: -1}}, router.Event{Kind: router.EventJoined, Device: phone})
+	if len(errs) > 0 || len(ep.received()) != 3 {
+		t.Errorf("expected success on third attempt, got %d requests, errors %v", len(ep.received()), errs)
+	}
+
+	ep = newEndpoint(t, 500, 500, 500)
+	errs = notifyAll(t, []Webhook{{Name: "hook", URL: ep.URL, Retries: 2}}, router.Event{Kind: router.EventJoined, Device: phone})
+	if len(errs) != 1 || len(ep.received()) != 3 {
+		t.Errorf("expected to give up after 3 attempts, got %d requests, errors %v", len(ep.received()), errs)
+	}
+
+	// client errors are not retried
+	ep = newEndpoint(t, http.StatusBadRequest)
+	errs = notifyAll(t, []Webhook{{Name: "hook", URL: ep.URL, Retries: -1}}, router.Event{Kind: router.EventJoined, Device: phone})
+	if len(errs) != 1 || len(ep.received()) != 1 {
+		t.Errorf("expected a single attempt, got %d requests, errors %v", len(ep.received()), errs)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]Webhook{
+		"unknown type":     {URL: "http://x", Type: "email"},
+		"gotify token":     {URL: "http://x", Type: TypeGotify},
+		"unknown event":    {URL: "http://x", Events: []router.EventKind{"arrived"}},
+		"invalid template": {URL: "http://x", Template: "{{.Name"},
+		"unescaped json":   {URL: "http://x", Template: `{"who": "{{.Name}}"}`},
+		"not json":         {URL: "http://x", Template: `{{.Name}} {{.Event}}`},
+	}
+	for name, w := range tests {
+		if _, err := New([]Webhook{w}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+//go:build ignore
+
+// gen downloads the IEEE MA-L registry and writes it in the format of
+// oui.txt. Run it with "go generate ./internal/oui", or pass -in to use a
+// previously downloaded oui.csv.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const registryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+func main() {
+	in := flag.String("in", "", "read the registry from this CSV file instead of downloading it")
+	out := flag.String("o", "oui.txt", "output file")
+	flag.Parse()
+
+	var r io.Reader
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	} else {
+		c := &http.Client{Timeout: 2 * time.Minute}
+		resp, err := c.Get(registryURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("downloading %s: %s", registryURL, resp.Status)
+		}
+		r = resp.Body
+	}
+
+	vendors, err := parse(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(vendors) == 0 {
+		log.Fatal("registry contains no assignments")
+	}
+
+	prefixes := make([]string, 0, len(vendors))
+	for p := range vendors {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	var b strings.Builder
+	for _, p := range prefixes {
+		fmt.Fprintf(&b, "%s\t%s\n", p, vendors[p])
+	}
+	if err := os.WriteFile(*out, []byte(b.String()), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d assignments to %s", len(prefixes), *out)
+}
+
+// parse reads the MA-L assignments from the IEEE CSV export
+// (Registry,Assignment,Organization Name,Organization Address)
+func parse(r io.Reader) (map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	vendors := map[string]string{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return vendors, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 3 || rec[0] != "MA-L" {
+			continue
+		}
+		prefix := strings.ToUpper(strings.TrimSpace(rec[1]))
+		name := strings.Join(strings.Fields(rec[2]), " ")
+		if len(prefix) == 6 && name != "" {
+			vendors[prefix] = name
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package oui maps MAC addresses to their vendor using an embedded table of
+// IEEE MA-L (OUI) assignments.
+//
+// oui.txt holds one "AABBCC<TAB>Organization" line per assignment, sorted by
+// prefix, as written by gen.go from the IEEE registry. Refresh it with
+//
+//	go generate ./internal/oui
+//
+// or, with a previously downloaded copy of the registry's oui.csv, with
+// "go run gen.go -in oui.csv -o oui.txt" in this directory.
+//
+//go:generate go run gen.go -o oui.txt
+package oui
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+//go:embed oui.txt
+var data string
+
+var (
+	loadOnce sync.Once
+	vendors  map[string]string // keyed by uppercase 6 hex digit prefix
+)
+
+func load() {
+	vendors = map[string]string{}
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		prefix, name, ok := strings.Cut(sc.Text(), "\t")
+		if ok && len(prefix) == 6 {
+			vendors[prefix] = name
+		}
+	}
+}
+
+// Len returns the number of assignments in the embedded table
+func Len() int {
+	loadOnce.Do(load)
+	return len(vendors)
+}
+
+// prefix returns the first three octets of mac as 6 uppercase hex digits,
+// ignoring separators, or "" if mac is too short or not hexadecimal
+func prefix(mac string) string {
+	b := make([]byte, 0, 6)
+	for i := 0; i < len(mac) && len(b) < 6; i++ {
+		c := mac[i]
+		switch {
+		case c == ':' || c == '-' || c == '.' || c == ' ':
+			continue
+		case c >= '0' && c <= '9', c >= 'A' && c <= 'F':
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 'A'
+		default:
+			return ""
+		}
+		b = append(b, c)
+	}
+	if len(b) < 6 {
+		return ""
+	}
+	return string(b)
+}
+
+// Lookup returns the organization the OUI of mac is assigned to, or "" if
+// it is unknown. Locally administered addresses are never assigned.
+func Lookup(mac string) string {
+	p := prefix(mac)
+	if p == "" || LocallyAdministered(mac) {
+		return ""
+	}
+	loadOnce.Do(load)
+	return vendors[p]
+}
+
+// LocallyAdministered reports whether the locally administered bit of mac
+// is set. Such addresses are not assigned by the IEEE; phones and laptops
+// use them as randomized per-network addresses, so they may change and
+// don't identify a device across networks (or sometimes days).
+func LocallyAdministered(mac string) bool {
+	p := prefix(mac)
+	if p == "" {
+		return false
+	}
+	// the second-least significant bit of the first octet
+	switch p[1] {
+	case '2', '3', '6', '7', 'A', 'B', 'E', 'F':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package oui
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		mac, want string
+	}{
+		{"B8:27:EB:12:34:56", "Raspberry Pi Foundation"},
+		{"b8-27-eb-12-34-56", "Raspberry Pi Foundation"},
+		{"b827.eb12.3456", "Raspberry Pi Foundation"},
+		{"00:00:00:00:00:01", ""},
+		{"02:11:32:00:00:01", ""}, // locally administered
+		{"b8:27", ""},
+		{"not a mac", ""},
+	}
+	for _, tt := range tests {
+		if got := Lookup(tt.mac); got != tt.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestLocallyAdministered(t *testing.T) {
+	for mac, want := range map[string]bool{
+		"00:11:32:00:00:01": false,
+		"02:00:5E:10:00:01": true,
+		"DA:A1:19:00:00:01": true,
+		"ae:bb:cc:dd:ee:ff": true,
+		"f4:f5:d8:00:00:01": false,
+		"":                  false,
+	} {
+		if got := LocallyAdministered(mac); got != want {
+			t.Errorf("LocallyAdministered(%q) = %t, want %t", mac, got, want)
+		}
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	// the MA-L registry has well over 30,000 assignments, a table with
+	// fewer is a sample rather than the registry
+	if n := Len(); n < 30000 {
+		t.Fatalf("embedded database has %d assignments, regenerate it with go generate ./internal/oui", n)
+	}
+}
@@ -0,0 +1,295 @@
+// Package presence debounces the Active flag of router devices, so that
+// phones briefly dropping off the host table while asleep are still
+// reported as home.
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/filelock"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// forgetAfter is how long the state of a device that is away is kept
+const forgetAfter = 30 * 24 * time.Hour
+
+// Policy configures when a device changes between home and away. A device
+// that is home becomes away once it has been missed by at least AwayMisses
+// consecutive polls and has not been seen for at least AwayAfter; a zero
+// threshold does not delay the transition. A device that is away becomes
+// home after HomeHits consecutive sightings (at least one).
+//
+// The state is discarded when the previous poll is older than StateTTL
+// (default AwayAfter plus 15 minutes), as devices may have come and gone
+// in the meantime. Policies counting misses of infrequent polls, e.g. from
+// cron, need a StateTTL longer than the poll interval.
+type Policy struct {
+	AwayAfter  time.Duration
+	AwayMisses int
+	HomeHits   int
+	StateTTL   time.Duration
+}
+
+// Enabled reports whether the policy delays any transition
+func (p Policy) Enabled() bool {
+	return p.AwayAfter > 0 || p.AwayMisses > 1 || p.HomeHits > 1
+}
+
+// staleAfter is how old the previous poll may be for its state to still
+// apply
+func (p Policy) staleAfter() time.Duration {
+	if p.StateTTL > 0 {
+		return p.StateTTL
+	}
+	return p.AwayAfter + 15*time.Minute
+}
+
+// deviceState is the persisted state of one device
+type deviceState struct {
+	Device   router.Device `json:"device"` // latest identity from the host table
+	Home     bool          `json:"home"`
+	LastSeen time.Time     `json:"last_seen,omitempty"`
+	Hits     int           `json:"hits,omitempty"`   // consecutive sightings while away
+	Misses   int           `json:"misses,omitempty"` // consecutive misses while home
+}
+
+// stateFile is the on-disk form of a Tracker
+type stateFile struct {
+	Updated time.Time               `json:"updated"`
+	Devices map[string]*deviceState `json:"devices"`
+}
+
+// Tracker applies a Policy to successive host tables
+type Tracker struct {
+	policy  Policy
+	updated time.Time
+	devices map[string]*deviceState // keyed by normalized MAC
+}
+
+// NewTracker returns a Tracker without any prior state
+func NewTracker(p Policy) *Tracker {
+	return &Tracker{policy: p, devices: map[string]*deviceState{}}
+}
+
+// DefaultPath returns the default state file, usually
+// ~/.local/state/am-i-home/presence.json. Each profile gets its own file.
+func DefaultPath(profile string) string {
+	dir := config.StateDir()
+	if dir == "" {
+		return ""
+	}
+	name := "presence.json"
+	if profile != "" {
+		name = "presence-" + profile + ".json"
+	}
+	return filepath.Join(dir, name)
+}
+
+// Load reads the Tracker state saved at path. A missing file yields a
+// Tracker without prior state.
+func Load(path string, p Policy) (*Tracker, error) {
+	t := NewTracker(p)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("failed reading presence state: %w", err)
+	}
+
+	var sf stateFile
+	if err := json.Unmarshal(b, &sf); err != nil {
+		return nil, fmt.Errorf("failed parsing presence state %s: %w", path, err)
+	}
+	t.updated = sf.Updated
+	if sf.Devices != nil {
+		t.devices = sf.Devices
+	}
+	return t, nil
+}
+
+// Save writes the Tracker state to path, replacing it atomically
+func (t *Tracker) Save(path string) error {
+	b, err := json.MarshalIndent(stateFile{Updated: t.updated, Devices: t.devices}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed creating state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed writing presence state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed writing presence state: %w", err)
+	}
+	return nil
+}
+
+// Update feeds the host table observed at now into the state machine and
+// returns it with debounced Active flags. Devices that have dropped off
+// the host table but still count as home are appended (sorted by MAC)
+// with their last known identity.
+//
+// Devices without prior state (or if the previous update is too old to
+// still apply) take their observed state as is.
+func (t *Tracker) Update(now time.Time, devs []router.Device) []router.Device {
+	if !t.updated.IsZero() && now.Sub(t.updated) > t.policy.staleAfter() {
+		t.devices = map[string]*deviceState{}
+	}
+	t.updated = now
+
+	out := make([]router.Device, 0, len(devs))
+	seen := map[string]bool{}
+	for _, d := range devs {
+		key := router.NormalizeMAC(d.MAC)
+		seen[key] = true
+
+		st, ok := t.devices[key]
+		if !ok {
+			st = &deviceState{Home: d.Active}
+			t.devices[key] = st
+			if d.Active {
+				st.LastSeen = now
+			}
+		} else {
+			t.observe(st, now, d.Active)
+		}
+		st.Device = d
+
+		d.Active = st.Home
+		out = append(out, d)
+	}
+
+	var missing []router.Device
+	for key, st := range t.devices {
+		if seen[key] {
+			continue
+		}
+		t.observe(st, now, false)
+		if st.Home {
+			d := st.Device
+			d.Active = true
+			missing = append(missing, d)
+		} else if now.Sub(st.LastSeen) > forgetAfter {
+			delete(t.devices, key)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].MAC < missing[j].MAC })
+	return append(out, missing...)
+}
+
+// observe advances the state machine of one device
+func (t *Tracker) observe(st *deviceState, now time.Time, active bool) {
+	if active {
+		st.LastSeen = now
+		st.Misses = 0
+		if !st.Home {
+			st.Hits++
+			if st.Hits >= t.policy.HomeHits {
+				st.Home, st.Hits = true, 0
+			}
+		}
+		return
+	}
+
+	st.Hits = 0
+	if !st.Home {
+		return
+	}
+	st.Misses++
+	if st.Misses >= t.policy.AwayMisses && now.Sub(st.LastSeen) >= t.policy.AwayAfter {
+		st.Home, st.Misses = false, 0
+	}
+}
+
+// Debouncer wraps a RouterClient and debounces the Active flag of the
+// devices it returns. When Path is set, the state is loaded before and
+// saved after every ListConnected call, so that one-shot invocations
+// share it; a lock file keeps concurrent processes from overwriting each
+// other's updates. Errors locking, reading or saving the state are passed
+// to OnError (if set) and never fail the wrapped call; unreadable state is
+// discarded.
+type Debouncer struct {
+	router.RouterClient
+	Policy  Policy
+	Path    string
+	OnError func(error)
+
+	mu      sync.Mutex
+	tracker *Tracker
+}
+
+// ListConnected implements router.RouterClient
+func (d *Debouncer) ListConnected() ([]router.Device, error) {
+	return d.ListConnectedContext(context.Background())
+}
+
+// ListConnectedContext implements router.ContextClient
+func (d *Debouncer) ListConnectedContext(ctx context.Context) ([]router.Device, error) {
+	devs, err := router.ListConnectedContext(ctx, d.RouterClient)
+	if err != nil {
+		return devs, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Path != "" {
+		unlock, err := filelock.Lock(d.Path)
+		if err != nil {
+			if d.OnError != nil {
+				d.OnError(err)
+			}
+		} else {
+			defer unlock()
+		}
+
+		// reload on every call, other invocations may have updated the state
+		t, err := Load(d.Path, d.Policy)
+		if err != nil {
+			if d.OnError != nil {
+				d.OnError(err)
+			}
+			t = NewTracker(d.Policy)
+		}
+		d.tracker = t
+	} else if d.tracker == nil {
+		d.tracker = NewTracker(d.Policy)
+	}
+
+	devs = d.tracker.Update(time.Now(), devs)
+	if d.Path != "" {
+		if err := d.tracker.Save(d.Path); err != nil && d.OnError != nil {
+			d.OnError(err)
+		}
+	}
+	return devs, nil
+}
+
+// Login forwards to the wrapped client if it supports sessions
+func (d *Debouncer) Login() error {
+	if s, ok := d.RouterClient.(router.SessionClient); ok {
+		return s.Login()
+	}
+	return nil
+}
+
+// Close forwards to the wrapped client if it supports sessions
+func (d *Debouncer) Close() error {
+	if s, ok := d.RouterClient.(router.SessionClient); ok {
+		return s.Close()
+	}
+	return nil
+}
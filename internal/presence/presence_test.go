@@ -0,0 +1,189 @@
+package presence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+var (
+	phone = router.Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true}
+	base  = time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+)
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+// homeAt reports whether the phone is active in the tracker's output
+func homeAt(tr *Tracker, minutes int, devs ...router.Device) bool {
+	for _, d := range tr.Update(at(minutes), devs) {
+		if d.MAC == phone.MAC {
+			return d.Active
+		}
+	}
+	return false
+}
+
+func TestAwayMisses(t *testing.T) {
+	tr := NewTracker(Policy{AwayMisses: 3})
+
+	if !homeAt(tr, 0, phone) {
+		t.Fatal("expected an active device without prior state to be home")
+	}
+	// dropping off the host table twice is tolerated
+	if !homeAt(tr, 1) || !homeAt(tr, 2) {
+		t.Fatal("expected phone to stay home for two misses")
+	}
+	// seen again, the misses start over
+	homeAt(tr, 3, phone)
+	inactive := phone
+	inactive.Active = false
+	if !homeAt(tr, 4, inactive) || !homeAt(tr, 5) {
+		t.Fatal("expected misses to be reset by a sighting")
+	}
+	if homeAt(tr, 6) {
+		t.Error("expected phone to be away after three consecutive misses")
+	}
+}
+
+func TestAwayAfterAndHomeHits(t *testing.T) {
+	tr := NewTracker(Policy{AwayAfter: 5 * time.Minute, HomeHits: 2})
+
+	homeAt(tr, 0, phone)
+	if !homeAt(tr, 4) {
+		t.Fatal("expected phone to stay home within away_after")
+	}
+	if homeAt(tr, 5) {
+		t.Fatal("expected phone to be away once away_after has passed")
+	}
+	if homeAt(tr, 6, phone) {
+		t.Error("expected a single sighting not to be enough to be home")
+	}
+	if homeAt(tr, 7) || homeAt(tr, 8, phone) {
+		t.Error("expected a miss to reset the sightings")
+	}
+	if !homeAt(tr, 9, phone) {
+		t.Error("expected phone to be home after two consecutive sightings")
+	}
+}
+
+func TestMissingDeviceKeepsIdentity(t *testing.T) {
+	tr := NewTracker(Policy{AwayMisses: 2})
+	tr.Update(at(0), []router.Device{phone})
+
+	devs := tr.Update(at(1), nil)
+	if len(devs) != 1 || !reflect.DeepEqual(devs[0], phone) {
+		t.Errorf("expected missing phone to be reported with its last identity, got %+v", devs)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "presence.json")
+	p := Policy{AwayMisses: 2}
+
+	for i, want := range []bool{true, true, false} {
+		tr, err := Load(path, p)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		var devs []router.Device
+		if i == 0 {
+			devs = []router.Device{phone}
+		}
+		if got := homeAt(tr, i, devs...); got != want {
+			t.Errorf("invocation %d: home = %v, want %v", i, got, want)
+		}
+		if err := tr.Save(path); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	// state older than the policy allows is discarded
+	tr, _ := Load(path, p)
+	tr.Update(at(3), []router.Device{phone})
+	tr.Save(path)
+	tr, _ = Load(path, p)
+	if homeAt(tr, 60) {
+		t.Error("expected stale state to be discarded")
+	}
+}
+
+func TestStateTTL(t *testing.T) {
+	// hourly polls counting misses need state older than the default TTL
+	tr := NewTracker(Policy{AwayMisses: 2, StateTTL: 2 * time.Hour})
+	homeAt(tr, 0, phone)
+	if !homeAt(tr, 60) {
+		t.Error("expected a single miss to keep the phone home")
+	}
+	if homeAt(tr, 120) {
+		t.Error("expected the phone to be gone after two misses")
+	}
+}
+
+func TestDebouncerConcurrentProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presence.json")
+	p := Policy{AwayMisses: 2}
+
+	// debouncers with their own devices stand in for separate processes;
+	// none may lose the other's state
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := &Debouncer{
+				RouterClient: staticClient{{MAC: fmt.Sprintf("AA:BB:CC:DD:EE:%02X", i), Active: true}},
+				Policy:       p,
+				Path:         path,
+				OnError:      func(err error) { t.Error(err) },
+			}
+			d.ListConnected()
+		}()
+	}
+	wg.Wait()
+
+	tr, err := Load(path, p)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(tr.devices) != 10 {
+		t.Errorf("expected 10 devices in the state, got %d", len(tr.devices))
+	}
+}
+
+func TestDebouncerDiscardsCorruptState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "presence.json")
+	os.WriteFile(path, []byte("{not json"), 0o600)
+
+	var errs []error
+	d := &Debouncer{
+		RouterClient: staticClient{phone},
+		Policy:       Policy{AwayMisses: 2},
+		Path:         path,
+		OnError:      func(err error) { errs = append(errs, err) },
+	}
+	devs, err := d.ListConnected()
+	if err != nil || len(devs) != 1 || !devs[0].Active {
+		t.Fatalf("ListConnected() = %+v, %v", devs, err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected the corrupt state to be reported, got %v", errs)
+	}
+	if _, err := Load(path, d.Policy); err != nil {
+		t.Errorf("expected state to be rewritten, got %v", err)
+	}
+}
+
+// staticClient is a RouterClient returning fixed devices
+type staticClient []router.Device
+
+func (c staticClient) ListConnected() ([]router.Device, error) {
+	return c, nil
+}
@@ -0,0 +1,303 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeRouter is implemented by the fake servers used in the shared backend tests
+type fakeRouter interface {
+	url() string
+	stats() (logins, logouts int)
+	expireSessions()
+	// delayTable makes fetching the host table take d
+	delayTable(d time.Duration)
+	// failNext answers the next n requests with 503 Service Unavailable
+	failNext(n int)
+}
+
+func (f *fakeUbus) url() string { return f.URL }
+
+var backendDevices = []Device{
+	{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true},
+	{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: false},
+}
+
+// backendFakes maps each backend name to a constructor for its fake router
+var backendFakes = map[string]func(t *testing.T, user, pass string, devices []Device) fakeRouter{
+	"openwrt": func(t *testing.T, user, pass string, devices []Device) fakeRouter {
+		return newFakeUbus(t, user, pass, devices)
+	},
+}
+
+// TestBackends runs the same behavioural tests against every registered
+// backend using its fake router
+func TestBackends(t *testing.T) {
+	for _, name := range Backends() {
+		newFake, ok := backendFakes[name]
+		if !ok {
+			t.Errorf("backend %q has no fake router for the shared tests", name)
+			continue
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("lists devices and logs out", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				c, err := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "secret"})
+				if err != nil {
+					t.Fatalf("New failed: %v", err)
+				}
+
+				devs, err := c.ListConnected()
+				if err != nil {
+					t.Fatalf("ListConnected failed: %v", err)
+				}
+				sort.Slice(devs, func(i, j int) bool { return devs[i].MAC < devs[j].MAC })
+				if len(devs) != len(backendDevices) {
+					t.Fatalf("expected %d devices, got %+v", len(backendDevices), devs)
+				}
+				for i, want := range backendDevices {
+					got := devs[i]
+					if !MatchMAC(got.MAC, want.MAC) || got.IP != want.IP || got.Hostname != want.Hostname || got.Active != want.Active {
+						t.Errorf("device %d: got %+v, want %+v", i, got, want)
+					}
+				}
+
+				if logins, logouts := f.stats(); logins != 1 || logouts != 1 {
+					t.Errorf("expected 1 login and 1 logout, got %d and %d", logins, logouts)
+				}
+			})
+
+			t.Run("rejects wrong password", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				c, _ := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "wrong"})
+
+				_, err := c.ListConnected()
+				var e *Error
+				if !errors.Is(err, ErrBadCredentials) || !errors.As(err, &e) || e.Code == "" {
+					t.Fatalf("expected ErrBadCredentials with the router's code, got %v", err)
+				}
+			})
+
+			t.Run("reports an unreachable router", func(t *testing.T) {
+				srv := httptest.NewServer(http.NotFoundHandler())
+				srv.Close()
+				c, _ := New(name, Config{BaseURL: srv.URL, User: "admin", Pass: "secret"})
+
+				if _, err := c.ListConnected(); !errors.Is(err, ErrUnreachable) {
+					t.Fatalf("expected ErrUnreachable, got %v", err)
+				}
+			})
+
+			t.Run("times out fetching the host table and logs out", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				f.delayTable(time.Second)
+				c, _ := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "secret", Timeouts: Timeouts{Table: 50 * time.Millisecond}})
+
+				_, err := c.ListConnected()
+				if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrUnreachable) {
+					t.Fatalf("expected an unreachable router and deadline exceeded, got %v", err)
+				}
+				if logins, logouts := f.stats(); logins != 1 || logouts != 1 {
+					t.Errorf("expected 1 login and 1 logout, got %d and %d", logins, logouts)
+				}
+			})
+
+			t.Run("logs out when cancelled", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				f.delayTable(time.Second)
+				c, _ := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "secret"})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				start := time.Now()
+				_, err := ListConnectedContext(ctx, c)
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("expected the context's error, got %v", err)
+				}
+				if d := time.Since(start); d > 500*time.Millisecond {
+					t.Errorf("cancellation took %s", d)
+				}
+				if logins, logouts := f.stats(); logins != 1 || logouts != 1 {
+					t.Errorf("expected 1 login and 1 logout, got %d and %d", logins, logouts)
+				}
+			})
+
+			t.Run("retries transient errors", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				f.failNext(2)
+				c, _ := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "secret", Retry: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+
+				if _, err := c.ListConnected(); err != nil {
+					t.Fatalf("ListConnected failed: %v", err)
+				}
+				if logins, logouts := f.stats(); logins != 1 || logouts != 1 {
+					t.Errorf("expected 1 login and 1 logout, got %d and %d", logins, logouts)
+				}
+			})
+
+			t.Run("reuses and renews sessions", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				c, _ := New(name, Config{BaseURL: f.url(), User: "admin", Pass: "secret"})
+				sc, ok := c.(SessionClient)
+				if !ok {
+					t.Skip("backend does not support sessions")
+				}
+
+				if err := sc.Login(); err != nil {
+					t.Fatalf("Login failed: %v", err)
+				}
+				for i := 0; i < 3; i++ {
+					if _, err := sc.ListConnected(); err != nil {
+						t.Fatalf("ListConnected failed: %v", err)
+					}
+				}
+				if logins, logouts := f.stats(); logins != 1 || logouts != 0 {
+					t.Errorf("expected 1 login and no logout, got %d and %d", logins, logouts)
+				}
+
+				f.expireSessions()
+				if _, err := sc.ListConnected(); err != nil {
+					t.Fatalf("ListConnected after expiry failed: %v", err)
+				}
+				if logins, _ := f.stats(); logins != 2 {
+					t.Errorf("expected a second login after expiry, got %d", logins)
+				}
+
+				sc.Close()
+				if _, logouts := f.stats(); logouts < 1 {
+					t.Errorf("expected Close to log out")
+				}
+			})
+		})
+	}
+}
+
+// deadPID returns the id of a process that has exited
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("can't start a process: %v", err)
+	}
+	return cmd.ProcessState.Pid()
+}
+
+// TestBackendSessions checks that sessions recorded in a SessionStore are
+// logged out by the next run if their process is gone
+func TestBackendSessions(t *testing.T) {
+	for _, name := range Backends() {
+		newFake, ok := backendFakes[name]
+		if !ok {
+			continue
+		}
+
+		t.Run(name, func(t *testing.T) {
+			// open a session and make it look like its process was killed
+			killedSession := func(t *testing.T) (fakeRouter, Config) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				cfg := Config{BaseURL: f.url(), User: "admin", Pass: "secret", Sessions: NewSessionStore(filepath.Join(t.TempDir(), "sessions.json"))}
+				c, _ := New(name, cfg)
+				if err := c.(SessionClient).Login(); err != nil {
+					t.Fatalf("Login failed: %v", err)
+				}
+
+				key := SessionKey("admin", f.url())
+				sessions, err := cfg.Sessions.Sessions(key)
+				if err != nil || len(sessions) != 1 {
+					t.Fatalf("expected a recorded session, got %v, %v", sessions, err)
+				}
+				sess := sessions[0]
+				cfg.Sessions.Remove(key, sess.PID)
+				sess.PID = deadPID(t)
+				cfg.Sessions.Put(key, sess)
+				return f, cfg
+			}
+
+			t.Run("logs out a stale session before logging in", func(t *testing.T) {
+				f, cfg := killedSession(t)
+				c, _ := New(name, cfg)
+				if _, err := c.ListConnected(); err != nil {
+					t.Fatalf("ListConnected failed: %v", err)
+				}
+				if logins, logouts := f.stats(); logins != 2 || logouts != 2 {
+					t.Errorf("expected 2 logins and 2 logouts, got %d and %d", logins, logouts)
+				}
+				if sessions, _ := cfg.Sessions.Sessions(SessionKey("admin", f.url())); len(sessions) != 0 {
+					t.Errorf("expected no recorded session after logging out, got %+v", sessions)
+				}
+			})
+
+			t.Run("resets a recorded session", func(t *testing.T) {
+				f, cfg := killedSession(t)
+				c, _ := New(name, cfg)
+				r := c.(SessionResetter)
+
+				if ok, err := r.ResetSession(context.Background(), false); !ok || err != nil {
+					t.Fatalf("ResetSession() = %v, %v", ok, err)
+				}
+				if _, logouts := f.stats(); logouts != 1 {
+					t.Errorf("expected 1 logout, got %d", logouts)
+				}
+				if ok, err := r.ResetSession(context.Background(), false); ok || err != nil {
+					t.Errorf("second ResetSession() = %v, %v, expected nothing to reset", ok, err)
+				}
+			})
+
+			t.Run("only forgets its own session", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				cfg := Config{BaseURL: f.url(), User: "admin", Pass: "secret", Sessions: NewSessionStore(filepath.Join(t.TempDir(), "sessions.json"))}
+				key := SessionKey("admin", f.url())
+				// a daemon running as the parent process
+				daemon := Session{ID: "daemon", Cookies: map[string]string{"sid": "daemon"}, PID: os.Getppid(), Started: time.Now()}
+				cfg.Sessions.Put(key, daemon)
+
+				bad := cfg
+				bad.Pass = "wrong"
+				c, _ := New(name, bad)
+				if _, err := c.ListConnected(); err == nil {
+					t.Fatal("expected the login to fail")
+				}
+				c, _ = New(name, cfg)
+				if _, err := c.ListConnected(); err != nil {
+					t.Fatalf("ListConnected failed: %v", err)
+				}
+
+				sessions, err := cfg.Sessions.Sessions(key)
+				if err != nil || len(sessions) != 1 || sessions[0].PID != daemon.PID {
+					t.Errorf("expected only the daemon's session to be left, got %+v, %v", sessions, err)
+				}
+			})
+
+			t.Run("keeps sessions of running processes", func(t *testing.T) {
+				f := newFake(t, "admin", "secret", backendDevices)
+				cfg := Config{BaseURL: f.url(), User: "admin", Pass: "secret", Sessions: NewSessionStore(filepath.Join(t.TempDir(), "sessions.json"))}
+				c, _ := New(name, cfg)
+				if err := c.(SessionClient).Login(); err != nil {
+					t.Fatalf("Login failed: %v", err)
+				}
+
+				r, _ := New(name, cfg)
+				if _, err := r.(SessionResetter).ResetSession(context.Background(), false); err == nil {
+					t.Error("expected an error resetting the session of a running process")
+				}
+				if ok, err := r.(SessionResetter).ResetSession(context.Background(), true); !ok || err != nil {
+					t.Errorf("forced ResetSession() = %v, %v", ok, err)
+				}
+			})
+		})
+	}
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	if _, err := New("carrier-pigeon", Config{}); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
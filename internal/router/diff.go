@@ -0,0 +1,61 @@
+package router
+
+// EventKind describes how a device changed between two snapshots
+type EventKind string
+
+const (
+	EventJoined    EventKind = "joined"
+	EventLeft      EventKind = "left"
+	EventIPChanged EventKind = "ip-changed"
+)
+
+// Event is a single presence change detected by DiffDevices.
+// PrevIP is only set for EventIPChanged.
+type Event struct {
+	Kind   EventKind
+	Device Device
+	PrevIP string
+}
+
+// DiffDevices compares two snapshots of the host table and returns the
+// presence changes between them. Devices are identified by their normalized
+// MAC address and only active devices count as present. Events for devices
+// in cur come first (in cur's order), followed by departures in prev's order.
+func DiffDevices(prev, cur []Device) []Event {
+	before := make(map[string]Device, len(prev))
+	for _, d := range prev {
+		if d.Active {
+			before[NormalizeMAC(d.MAC)] = d
+		}
+	}
+
+	var events []Event
+	seen := make(map[string]bool, len(cur))
+	for _, d := range cur {
+		if !d.Active {
+			continue
+		}
+		key := NormalizeMAC(d.MAC)
+		seen[key] = true
+
+		old, ok := before[key]
+		switch {
+		case !ok:
+			events = append(events, Event{Kind: EventJoined, Device: d})
+		case old.IP != d.IP:
+			events = append(events, Event{Kind: EventIPChanged, Device: d, PrevIP: old.IP})
+		}
+	}
+
+	for _, d := range prev {
+		key := NormalizeMAC(d.MAC)
+		if !d.Active || seen[key] {
+			continue
+		}
+		// guard against duplicate entries in prev
+		seen[key] = true
+		events = append(events, Event{Kind: EventLeft, Device: d})
+	}
+
+	return events
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDevices(t *testing.T) {
+	phone := Device{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true}
+	laptop := Device{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: true}
+
+	t.Run("first snapshot reports all active devices as joined", func(t *testing.T) {
+		idle := Device{MAC: "AA:BB:CC:DD:EE:03", Hostname: "idle"}
+		got := DiffDevices(nil, []Device{phone, idle, laptop})
+		want := []Event{
+			{Kind: EventJoined, Device: phone},
+			{Kind: EventJoined, Device: laptop},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("no changes yields no events", func(t *testing.T) {
+		if got := DiffDevices([]Device{phone, laptop}, []Device{laptop, phone}); len(got) != 0 {
+			t.Errorf("expected no events, got %+v", got)
+		}
+	})
+
+	t.Run("device going inactive is reported as left", func(t *testing.T) {
+		inactive := phone
+		inactive.Active = false
+		got := DiffDevices([]Device{phone, laptop}, []Device{inactive, laptop})
+		want := []Event{{Kind: EventLeft, Device: phone}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("device missing from snapshot is reported as left", func(t *testing.T) {
+		got := DiffDevices([]Device{phone, laptop}, []Device{laptop})
+		want := []Event{{Kind: EventLeft, Device: phone}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("ip change is reported with previous address", func(t *testing.T) {
+		moved := phone
+		moved.IP = "192.168.0.11"
+		got := DiffDevices([]Device{phone}, []Device{moved})
+		want := []Event{{Kind: EventIPChanged, Device: moved, PrevIP: "192.168.0.10"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("MAC formatting differences are ignored", func(t *testing.T) {
+		reformatted := phone
+		reformatted.MAC = "aa-bb-cc-dd-ee-01"
+		if got := DiffDevices([]Device{phone}, []Device{reformatted}); len(got) != 0 {
+			t.Errorf("expected no events, got %+v", got)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kinds of router errors, to be tested with errors.Is. All errors the
+// built-in backends return from logging in and fetching devices match one
+// of them (besides context cancellation).
+var (
+	// ErrBadCredentials means the router rejected the user or password
+	ErrBadCredentials = errors.New("login failed with provided credentials")
+	// ErrSessionActive means the router refused the login because another
+	// session is open (HomeStation MSG_LOGIN_150)
+	ErrSessionActive = errors.New("another session is active on the router, log out first")
+	// ErrUnreachable means the router could not be reached, didn't answer
+	// in time or is temporarily unavailable (HTTP 5xx)
+	ErrUnreachable = errors.New("router unreachable")
+	// ErrProtocol means the router answered with something the client
+	// doesn't understand or with an unexpected error code
+	ErrProtocol = errors.New("unexpected router response")
+	// ErrCertificate means the router's HTTPS certificate is not trusted or
+	// doesn't match the pinned fingerprint
+	ErrCertificate = errors.New("router certificate not trusted")
+)
+
+// Error is an error from a router backend. It matches its Kind and the
+// underlying error with errors.Is and errors.As.
+type Error struct {
+	// Kind is ErrBadCredentials, ErrSessionActive, ErrUnreachable,
+	// ErrProtocol or ErrCertificate
+	Kind error
+	// Code is the raw message or status code reported by the router, e.g.
+	// "MSG_LOGIN_150", or "" if there is none
+	Code string
+	// Err is the underlying error, nil if Kind says it all
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Kind.Error()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Code != "" && !strings.Contains(msg, e.Code) {
+		msg += " (" + e.Code + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// loginFailureReason returns the Observer.LoginFailed reason for err
+func loginFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrBadCredentials):
+		return LoginFailureBadCredentials
+	case errors.Is(err, ErrSessionActive):
+		return LoginFailureSessionActive
+	case errors.Is(err, ErrUnreachable):
+		return LoginFailureNetwork
+	case errors.Is(err, ErrProtocol):
+		return LoginFailureProtocol
+	case errors.Is(err, ErrCertificate):
+		return LoginFailureCertificate
+	}
+	return LoginFailureUnknown
+}
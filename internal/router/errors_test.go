@@ -0,0 +1,33 @@
+package router
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection refused")
+	for _, tc := range []struct {
+		err  *Error
+		want string
+	}{
+		{&Error{Kind: ErrBadCredentials, Code: "MSG_LOGIN_1"}, "login failed with provided credentials (MSG_LOGIN_1)"},
+		{&Error{Kind: ErrUnreachable, Err: cause}, "router unreachable: connection refused"},
+		{&Error{Kind: ErrProtocol, Code: "6", Err: &ubusError{code: 6}}, "unexpected router response: ubus status 6"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+		if !errors.Is(tc.err, tc.err.Kind) {
+			t.Errorf("%v doesn't match its kind", tc.err)
+		}
+	}
+
+	err := &Error{Kind: ErrUnreachable, Err: cause}
+	if !errors.Is(err, cause) || errors.Is(err, ErrProtocol) {
+		t.Errorf("unexpected matches for %v", err)
+	}
+	if got := loginFailureReason(err); got != LoginFailureNetwork {
+		t.Errorf("got reason %q, want %q", got, LoginFailureNetwork)
+	}
+}
@@ -1,39 +1,177 @@
 package router
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/pbkdf2"
 )
 
-// HomeStationClient implements RouterClient for Vodafone HomeStation-like routers
+// errSessionExpired is returned by fetchHostTbl when the router rejects the
+// request because the session is no longer valid
+var errSessionExpired = errors.New("session expired")
+
+// HomeStationClient implements RouterClient for Vodafone HomeStation-like routers.
+// By default every ListConnected call logs in and out again. After Login the
+// client keeps its session open (re-logging in transparently if it expires)
+// until Close is called.
 type HomeStationClient struct {
-	baseURL string
-	user    string
-	pass    string
-	client  *http.Client
+	baseURL  string
+	user     string
+	pass     string
+	client   *http.Client
+	timeout  time.Duration
+	timeouts Timeouts
+	retry    RetryPolicy
+
+	observer Observer
+	logger   *slog.Logger
+	trace    bool
+	tls      TLSConfig
+	sessions *SessionStore
+
+	mu          sync.Mutex
+	keepSession bool
+	loggedIn    bool
+	// sessionPID is the process whose recorded session the cookie jar
+	// holds, 0 if it holds none
+	sessionPID int
+}
+
+// Option configures optional HomeStationClient behaviour
+type Option func(*HomeStationClient)
+
+// WithObserver reports login and host table timings to o
+func WithObserver(o Observer) Option {
+	return func(h *HomeStationClient) {
+		h.observer = o
+	}
+}
+
+// WithLogger sends leveled logs to l
+func WithLogger(l *slog.Logger) Option {
+	return func(h *HomeStationClient) {
+		h.logger = l
+	}
+}
+
+// WithHTTPTrace logs every HTTP exchange at debug level with secrets
+// redacted (see WithLogger)
+func WithHTTPTrace() Option {
+	return func(h *HomeStationClient) {
+		h.trace = true
+	}
+}
+
+// WithTLS verifies the certificate of an https:// router according to c
+func WithTLS(c TLSConfig) Option {
+	return func(h *HomeStationClient) {
+		h.tls = c
+	}
+}
+
+// WithSessionStore records the open session in s, so that a later run can
+// log it out if this process is killed before it does
+func WithSessionStore(s *SessionStore) Option {
+	return func(h *HomeStationClient) {
+		h.sessions = s
+	}
+}
+
+// WithRetry retries failed logins and host table fetches according to p
+func WithRetry(p RetryPolicy) Option {
+	return func(h *HomeStationClient) {
+		h.retry = p
+	}
 }
 
-func NewHomeStationClient(baseURL, user, pass string) (*HomeStationClient, error) {
+// WithTimeout overrides DefaultTimeout for every phase not set by
+// WithTimeouts
+func WithTimeout(d time.Duration) Option {
+	return func(h *HomeStationClient) {
+		h.timeout = d
+	}
+}
+
+// WithTimeouts sets the timeouts of individual phases; zero phases keep
+// the timeout set by WithTimeout
+func WithTimeouts(t Timeouts) Option {
+	return func(h *HomeStationClient) {
+		h.timeouts = t
+	}
+}
+
+func NewHomeStationClient(baseURL, user, pass string, opts ...Option) (*HomeStationClient, error) {
 	jar, _ := cookiejar.New(nil)
-	httpClient := &http.Client{Jar: jar, Timeout: 10 * time.Second}
+	httpClient := &http.Client{Jar: jar}
+
+	h := &HomeStationClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		user:     user,
+		pass:     pass,
+		client:   httpClient,
+		observer: nopObserver{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.timeouts = h.timeouts.orDefault(h.timeout)
+	h.logger = discardLogger(h.logger).With("router", h.baseURL)
+	transport, err := newTransport(h.tls)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = transport
+	if h.trace {
+		httpClient.Transport = newTraceTransport(transport, h.logger)
+	}
+	return h, nil
+}
 
-	return &HomeStationClient{
-		baseURL: strings.TrimRight(baseURL, "/"),
-		user:    user,
-		pass:    pass,
-		client:  httpClient,
-	}, nil
+func init() {
+	Register("homestation", func(cfg Config) (RouterClient, error) {
+		var opts []Option
+		if cfg.Observer != nil {
+			opts = append(opts, WithObserver(cfg.Observer))
+		}
+		if cfg.Timeout > 0 {
+			opts = append(opts, WithTimeout(cfg.Timeout))
+		}
+		if cfg.Timeouts != (Timeouts{}) {
+			opts = append(opts, WithTimeouts(cfg.Timeouts))
+		}
+		if cfg.Logger != nil {
+			opts = append(opts, WithLogger(cfg.Logger))
+		}
+		if cfg.Trace {
+			opts = append(opts, WithHTTPTrace())
+		}
+		if cfg.TLS != (TLSConfig{}) {
+			opts = append(opts, WithTLS(cfg.TLS))
+		}
+		if cfg.Sessions != nil {
+			opts = append(opts, WithSessionStore(cfg.Sessions))
+		}
+		if cfg.Retry.MaxAttempts > 1 {
+			opts = append(opts, WithRetry(cfg.Retry))
+		}
+		return NewHomeStationClient(cfg.BaseURL, cfg.User, cfg.Pass, opts...)
+	})
 }
 
 // pbkdf2Hex computes PBKDF2-SHA256 and returns the result as lowercase hex
@@ -47,8 +185,8 @@ func pbkdf2Hex(password, salt string) string {
 // After successful login, the router requires a follow-up request before
 // other API endpoints become accessible. This mimics the browser's behavior
 // of reloading the page after login.
-func (h *HomeStationClient) activateSession() {
-	h.doGet(h.baseURL + "/api/v1/session/menu")
+func (h *HomeStationClient) activateSession(ctx context.Context) {
+	h.doGet(ctx, h.baseURL+"/api/v1/session/menu")
 }
 
 type saltResp struct {
@@ -58,21 +196,37 @@ type saltResp struct {
 }
 
 // tryLogin performs the two-step login using the salt and hashed password
-func (h *HomeStationClient) tryLogin() error {
+func (h *HomeStationClient) tryLogin(ctx context.Context) (err error) {
+	start := time.Now()
+	h.logger.Debug("logging in", "user", h.user)
+	defer func() {
+		if err == nil {
+			h.logger.Debug("logged in", "duration", time.Since(start))
+			h.observer.LoginSucceeded(time.Since(start))
+			return
+		}
+		reason := loginFailureReason(err)
+		h.logger.Warn("login failed", "reason", reason, "duration", time.Since(start), "error", err)
+		h.observer.LoginFailed(time.Since(start), reason)
+	}()
+
 	loginURL := h.baseURL + "/api/v1/session/login"
 
 	form := url.Values{}
 	form.Set("username", h.user)
 	form.Set("password", "seeksalthash")
 	// Use custom POST so we can set the same headers the browser sends
-	_, body, err := h.doPostForm(loginURL, form)
+	saltCtx, cancel := context.WithTimeout(ctx, h.timeouts.Salt)
+	_, body, err := h.doPostForm(saltCtx, loginURL, form)
+	cancel()
 	if err != nil {
-		return fmt.Errorf("failed requesting salt: %w", err)
+		return requestError(fmt.Errorf("failed requesting salt: %w", err))
 	}
 
 	var saltResponse saltResp
 	if err := json.Unmarshal(body, &saltResponse); err != nil {
-		return fmt.Errorf("failed parsing salt response: %w", err)
+		h.logger.Debug("unexpected salt response", "body", redactBody("", body))
+		return &Error{Kind: ErrProtocol, Err: fmt.Errorf("failed parsing salt response: %w", err)}
 	}
 
 	// We need both salt and saltwebui for the double-PBKDF2 algorithm
@@ -80,10 +234,10 @@ func (h *HomeStationClient) tryLogin() error {
 	saltWebUI := saltResponse.SaltWebUI
 
 	if salt == "" {
-		return errors.New("no salt returned from router")
+		return &Error{Kind: ErrProtocol, Code: saltResponse.Error, Err: errors.New("no salt returned from router")}
 	}
 	if saltWebUI == "" {
-		return errors.New("no saltwebui returned from router")
+		return &Error{Kind: ErrProtocol, Code: saltResponse.Error, Err: errors.New("no saltwebui returned from router")}
 	}
 
 	// Compute the double-PBKDF2 hash as per the router's login.js:
@@ -96,9 +250,11 @@ func (h *HomeStationClient) tryLogin() error {
 	form2 := url.Values{}
 	form2.Set("username", h.user)
 	form2.Set("password", finalHash)
-	_, resp2body, err := h.doPostForm(loginURL, form2)
+	loginCtx, cancel := context.WithTimeout(ctx, h.timeouts.Login)
+	defer cancel()
+	_, resp2body, err := h.doPostForm(loginCtx, loginURL, form2)
 	if err != nil {
-		return fmt.Errorf("failed posting hashed password: %w", err)
+		return requestError(fmt.Errorf("failed posting hashed password: %w", err))
 	}
 
 	// check JSON response for error=="ok"
@@ -106,26 +262,33 @@ func (h *HomeStationClient) tryLogin() error {
 	if err := json.Unmarshal(resp2body, &jr); err == nil {
 		if e, ok := jr["error"].(string); ok && e == "ok" {
 			// Activate the session (required before other API calls work)
-			h.activateSession()
+			h.activateSession(loginCtx)
 
 			return nil
 		}
 
-		// Router sometimes returns a message code such as MSG_LOGIN_150 when
-		// login is blocked (e.g. too many attempts). Check for that and return
-		// a clearer error to the caller.
-		if msg, ok := jr["message"].(string); ok && strings.Contains(msg, "MSG_LOGIN_150") {
-			return fmt.Errorf("An active session exists. Logout first. %s", msg)
+		// The router returns a message code such as MSG_LOGIN_1 for wrong
+		// credentials and MSG_LOGIN_150 when login is blocked because
+		// another session is open.
+		h.logger.Info("login rejected by router", "error", jr["error"], "message", jr["message"])
+		msg, _ := jr["message"].(string)
+		switch msg {
+		case "MSG_LOGIN_1":
+			return &Error{Kind: ErrBadCredentials, Code: msg}
+		case "MSG_LOGIN_150":
+			return &Error{Kind: ErrSessionActive, Code: msg}
 		}
+		return &Error{Kind: ErrProtocol, Code: msg}
 	}
 
-	return errors.New("login failed with provided credentials")
+	h.logger.Debug("unexpected login response", "body", redactBody("", resp2body))
+	return &Error{Kind: ErrProtocol, Err: errors.New("login response is not JSON")}
 }
 
 // doPostForm sends a POST with form-encoded body and returns the response and body bytes
-func (h *HomeStationClient) doPostForm(u string, form url.Values) (*http.Response, []byte, error) {
+func (h *HomeStationClient) doPostForm(ctx context.Context, u string, form url.Values) (*http.Response, []byte, error) {
 	bodyStr := form.Encode()
-	req, err := http.NewRequest("POST", u, strings.NewReader(bodyStr))
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(bodyStr))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -133,28 +296,34 @@ func (h *HomeStationClient) doPostForm(u string, form url.Values) (*http.Respons
 	h.setCommonHeaders(req)
 	// request-specific header
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return nil, nil, err
-	}
-	b, _ := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	return resp, b, nil
+	return h.do(req)
 }
 
 // doGet sends a GET with common headers and returns the response and body bytes
-func (h *HomeStationClient) doGet(u string) (*http.Response, []byte, error) {
-	req, err := http.NewRequest("GET", u, nil)
+func (h *HomeStationClient) doGet(ctx context.Context, u string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 	h.setCommonHeaders(req)
+	return h.do(req)
+}
+
+// do sends req and reads the whole response body, which may be cut short
+// by the request's context. Server errors are returned as errors.
+func (h *HomeStationClient) do(req *http.Request) (*http.Response, []byte, error) {
 	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
-	b, _ := io.ReadAll(resp.Body)
-	resp.Body.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, nil, &statusError{code: resp.StatusCode}
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
 	return resp, b, nil
 }
 
@@ -169,55 +338,327 @@ type hostTblResp struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
 	Data    struct {
-		HostTbl []struct {
-			Physaddress string `json:"physaddress"`
-			Ipaddress   string `json:"ipaddress"`
-			Hostname    string `json:"hostname"`
-			Active      string `json:"active"` // "true" / "false"
-		} `json:"hostTbl"`
+		HostTbl []hostTblEntry `json:"hostTbl"`
 	} `json:"data"`
 	Token string `json:"token"`
 }
 
-func (h *HomeStationClient) fetchHostTbl() ([]Device, error) {
-	_, body, err := h.doGet(h.baseURL + "/api/v1/host/hostTbl")
+// hostTblEntry is a host table row. The router reports every value as a
+// string; only the first four fields are always present.
+type hostTblEntry struct {
+	Physaddress   string `json:"physaddress"`
+	Ipaddress     string `json:"ipaddress"`
+	Hostname      string `json:"hostname"`
+	Active        string `json:"active"`        // "true" / "false"
+	InterfaceType string `json:"interfacetype"` // "Ethernet", "802.11"
+	Band          string `json:"band"`          // "2.4G", "5G"
+	SSID          string `json:"ssid"`
+	RSSI          string `json:"rssi"`          // dBm
+	IPv6Address   string `json:"ipv6address"`   // comma separated
+	LeaseTime     string `json:"leasetime"`     // remaining seconds
+	ConnectedTime string `json:"connectedtime"` // seconds
+	Vendor        string `json:"vendor"`
+}
+
+// device converts the entry, leaving unparsable optional values empty
+func (e hostTblEntry) device() Device {
+	d := Device{
+		MAC:      e.Physaddress,
+		IP:       e.Ipaddress,
+		Hostname: e.Hostname,
+		Active:   e.Active == "true",
+		SSID:     e.SSID,
+		Vendor:   e.Vendor,
+	}
+	switch strings.ToLower(e.InterfaceType) {
+	case "ethernet":
+		d.Interface = InterfaceEthernet
+	case "802.11", "wifi", "wi-fi", "wireless":
+		d.Interface = InterfaceWiFi
+	}
+	if e.Band != "" {
+		d.Band = NormalizeBand(e.Band)
+	}
+	d.Signal, _ = strconv.Atoi(e.RSSI)
+	for _, a := range strings.Split(e.IPv6Address, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			d.IPv6 = append(d.IPv6, a)
+		}
+	}
+	d.LeaseSeconds, _ = strconv.ParseInt(e.LeaseTime, 10, 64)
+	d.ConnectedSeconds, _ = strconv.ParseInt(e.ConnectedTime, 10, 64)
+	return identify(d)
+}
+
+func (h *HomeStationClient) fetchHostTbl(ctx context.Context) (devs []Device, err error) {
+	start := time.Now()
+	defer func() {
+		h.observer.HostTableFetched(time.Since(start), err)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeouts.Table)
+	defer cancel()
+	_, body, err := h.doGet(ctx, h.baseURL+"/api/v1/host/hostTbl")
 	if err != nil {
-		return nil, fmt.Errorf("failed fetching host table: %w", err)
+		return nil, requestError(fmt.Errorf("failed fetching host table: %w", err))
 	}
 
 	var r hostTblResp
 	if err := json.Unmarshal(body, &r); err != nil {
-		return nil, fmt.Errorf("failed parsing host table JSON: %w", err)
+		// an expired session is answered with the login page instead of JSON
+		return nil, &Error{Kind: ErrProtocol, Err: fmt.Errorf("failed parsing host table JSON: %w (%w)", err, errSessionExpired)}
 	}
 	if r.Error != "ok" {
-		return nil, fmt.Errorf("host table returned error: %s", r.Error)
+		return nil, &Error{Kind: ErrProtocol, Code: r.Message, Err: fmt.Errorf("host table returned error: %s (%w)", r.Error, errSessionExpired)}
 	}
 	var out []Device
 	for _, e := range r.Data.HostTbl {
-		active := false
-		if e.Active == "true" {
-			active = true
-		}
-		out = append(out, Device{MAC: e.Physaddress, IP: e.Ipaddress, Hostname: e.Hostname, Active: active})
+		out = append(out, e.device())
 	}
+	h.logger.Debug("fetched host table", "devices", len(out), "duration", time.Since(start))
 	return out, nil
 }
 
-// ListConnected logs in, returns connected devices, and logs out
+// fetch fetches the host table, retrying transient errors
+func (h *HomeStationClient) fetch(ctx context.Context) (devs []Device, err error) {
+	err = h.retry.do(ctx, h.logger, "host table", func() error {
+		devs, err = h.fetchHostTbl(ctx)
+		return err
+	})
+	return devs, err
+}
+
+// ListConnected returns connected devices. Without an open session it logs
+// in, fetches the host table and logs out again. With a session opened by
+// Login the session is reused and renewed once if the router rejects it.
 func (h *HomeStationClient) ListConnected() ([]Device, error) {
-	if err := h.tryLogin(); err != nil {
-		return nil, err
+	return h.ListConnectedContext(context.Background())
+}
+
+// ListConnectedContext is ListConnected with cancellation. If ctx is
+// cancelled while logging in or fetching the host table, the client still
+// logs out before returning ctx's error.
+func (h *HomeStationClient) ListConnectedContext(ctx context.Context) ([]Device, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.keepSession {
+		if err := h.login(ctx); err != nil {
+			return nil, err
+		}
+
+		// deferred, so that even a panic doesn't leave the session open
+		defer h.logout(ctx)
+		return h.fetch(ctx)
+	}
+
+	if !h.loggedIn {
+		if err := h.login(ctx); err != nil {
+			return nil, err
+		}
+		h.loggedIn = true
+	}
+
+	devices, err := h.fetch(ctx)
+	if !errors.Is(err, errSessionExpired) {
+		return devices, err
+	}
+
+	// drop whatever is left of the old session before logging in again,
+	// otherwise the router may refuse with MSG_LOGIN_150
+	h.logger.Info("session expired, logging in again", "error", err)
+	h.loggedIn = false
+	h.logout(ctx)
+	if err := h.login(ctx); err != nil {
+		return nil, fmt.Errorf("failed renewing session: %w", err)
+	}
+	h.loggedIn = true
+
+	return h.fetch(ctx)
+}
+
+// Login opens a session that is kept alive across ListConnected calls
+// until Close is called
+func (h *HomeStationClient) Login() error {
+	return h.LoginContext(context.Background())
+}
+
+// LoginContext is Login with cancellation
+func (h *HomeStationClient) LoginContext(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.loggedIn {
+		return nil
 	}
+	if err := h.login(ctx); err != nil {
+		return err
+	}
+	h.keepSession = true
+	h.loggedIn = true
+	return nil
+}
 
-	devices, err := h.fetchHostTbl()
+// Close logs out of a session opened by Login. Subsequent ListConnected
+// calls fall back to logging in and out on every call.
+func (h *HomeStationClient) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	h.logout()
+	if h.loggedIn {
+		h.logout(context.Background())
+	}
+	h.keepSession = false
+	h.loggedIn = false
+	return nil
+}
 
-	return devices, err
+// ResetSession implements SessionResetter
+func (h *HomeStationClient) ResetSession(ctx context.Context, force bool) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sessions == nil {
+		return false, nil
+	}
+	sessions, err := h.sessions.Sessions(h.sessionKey())
+	if err != nil {
+		return false, err
+	}
+	reset, inUse := false, 0
+	for _, sess := range sessions {
+		if !force && !sess.Stale() {
+			inUse = sess.PID
+			continue
+		}
+		h.restoreSession(sess)
+		if err := h.logout(ctx); err != nil {
+			h.sessionPID = 0
+			return reset, fmt.Errorf("failed logging out: %w", err)
+		}
+		reset = true
+	}
+	if !reset && inUse != 0 {
+		return false, fmt.Errorf("%w by process %d", ErrSessionInUse, inUse)
+	}
+	h.keepSession = false
+	h.loggedIn = false
+	return reset, nil
 }
 
-// logout ends the current session on the router
-func (h *HomeStationClient) logout() {
+// login calls tryLogin, first logging out a stale session recorded by an
+// earlier run, and retries it according to the retry policy. If an attempt
+// is cancelled or times out midway, the router may already have opened a
+// session, which is logged out again.
+func (h *HomeStationClient) login(ctx context.Context) error {
+	h.endStaleSession(ctx)
+	err := h.retry.do(ctx, h.logger, "login", func() error {
+		err := h.tryLogin(ctx)
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			h.logout(ctx)
+		}
+		return err
+	})
+	if err == nil {
+		h.recordSession()
+		return nil
+	}
+	if errors.Is(err, ErrSessionActive) && h.sessions != nil {
+		sessions, _ := h.sessions.Sessions(h.sessionKey())
+		if i := slices.IndexFunc(sessions, func(s Session) bool { return s.PID != os.Getpid() }); i >= 0 {
+			return fmt.Errorf("%w (opened by process %d at %s)", err, sessions[i].PID, sessions[i].Started.Format(time.DateTime))
+		}
+	}
+	return err
+}
+
+// logout ends the current session on the router. It is attempted even if
+// ctx is already cancelled, limited by the logout timeout.
+func (h *HomeStationClient) logout(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.timeouts.Logout)
+	defer cancel()
+
 	logoutURL := h.baseURL + "/api/v1/session/logout"
-	h.doPostForm(logoutURL, url.Values{})
+	if _, _, err := h.doPostForm(ctx, logoutURL, url.Values{}); err != nil {
+		// keep the recorded session, the next run tries again
+		h.logger.Warn("logout failed", "error", err)
+		return err
+	}
+	h.logger.Debug("logged out")
+	h.forgetSession()
+	return nil
+}
+
+func (h *HomeStationClient) sessionKey() string {
+	return SessionKey(h.user, h.baseURL)
+}
+
+// recordSession records the session cookies in the session store
+func (h *HomeStationClient) recordSession() {
+	if h.sessions == nil {
+		return
+	}
+	u, err := url.Parse(h.baseURL)
+	if err != nil {
+		return
+	}
+	sess := Session{Cookies: map[string]string{}, PID: os.Getpid(), Started: time.Now()}
+	for _, c := range h.client.Jar.Cookies(u) {
+		sess.Cookies[c.Name] = c.Value
+	}
+	if err := h.sessions.Put(h.sessionKey(), sess); err != nil {
+		h.logger.Warn("failed recording session", "error", err)
+		return
+	}
+	h.sessionPID = sess.PID
+}
+
+// forgetSession removes the recorded session that was just logged out from
+// the session store. Sessions of other processes are kept.
+func (h *HomeStationClient) forgetSession() {
+	if h.sessions == nil || h.sessionPID == 0 {
+		return
+	}
+	if err := h.sessions.Remove(h.sessionKey(), h.sessionPID); err != nil {
+		h.logger.Warn("failed forgetting session", "error", err)
+	}
+	h.sessionPID = 0
+}
+
+// restoreSession makes the next requests use the cookies of sess
+func (h *HomeStationClient) restoreSession(sess Session) {
+	u, err := url.Parse(h.baseURL)
+	if err != nil {
+		return
+	}
+	h.sessionPID = sess.PID
+	cookies := make([]*http.Cookie, 0, len(sess.Cookies))
+	for name, value := range sess.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	h.client.Jar.SetCookies(u, cookies)
+}
+
+// endStaleSession logs out a session recorded by a process that is gone
+// without logging out, as the router would refuse to log in again while it
+// is open
+func (h *HomeStationClient) endStaleSession(ctx context.Context) {
+	if h.sessions == nil {
+		return
+	}
+	sessions, err := h.sessions.Sessions(h.sessionKey())
+	if err != nil {
+		h.logger.Warn("failed reading recorded sessions", "error", err)
+		return
+	}
+	for _, sess := range sessions {
+		if !sess.Stale() {
+			continue
+		}
+		h.logger.Info("logging out stale session", "pid", sess.PID, "started", sess.Started)
+		h.restoreSession(sess)
+		h.logout(ctx)
+	}
+	// a session that couldn't be logged out stays recorded for the next run
+	h.sessionPID = 0
 }
@@ -0,0 +1,271 @@
+package router
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router/homestationtest"
+)
+
+// fakeHomeStation adapts the emulator to the shared backend tests
+type fakeHomeStation struct {
+	*homestationtest.Server
+}
+
+func newFakeHomeStation(t *testing.T, user, pass string, devices []Device) *fakeHomeStation {
+	hosts := make([]homestationtest.Host, 0, len(devices))
+	for _, d := range devices {
+		hosts = append(hosts, homestationtest.Host{MAC: d.MAC, IP: d.IP, Hostname: d.Hostname, Active: d.Active})
+	}
+	f := &fakeHomeStation{homestationtest.NewServer(user, pass, hosts)}
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeHomeStation) url() string                { return f.URL }
+func (f *fakeHomeStation) expireSessions()            { f.ExpireSessions() }
+func (f *fakeHomeStation) delayTable(d time.Duration) { f.SetHostTableDelay(d) }
+func (f *fakeHomeStation) failNext(n int)             { f.FailNext("", n, homestationtest.FaultUnavailable) }
+func (f *fakeHomeStation) stats() (int, int) {
+	s := f.Stats()
+	return s.Logins, s.Logouts
+}
+
+func init() {
+	backendFakes["homestation"] = func(t *testing.T, user, pass string, devices []Device) fakeRouter {
+		return newFakeHomeStation(t, user, pass, devices)
+	}
+}
+
+func TestPbkdf2HexMatchesEmulator(t *testing.T) {
+	got := pbkdf2Hex(pbkdf2Hex("secret", "salt"), "saltwebui")
+	if want := homestationtest.Hash("secret", "salt", "saltwebui"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if len(got) != 32 {
+		t.Errorf("expected 128 bit hex hash, got %d chars", len(got))
+	}
+}
+
+func TestHomeStationLogin(t *testing.T) {
+	t.Run("activates session and logs out", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		if _, err := c.ListConnected(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		stats := f.Stats()
+		if stats.Logins != 1 || stats.Activations != 1 || stats.HostTables != 1 || stats.Logouts != 1 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+		if f.OpenSessions() != 0 {
+			t.Errorf("expected no open sessions, got %d", f.OpenSessions())
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		c, _ := NewHomeStationClient(f.URL, "admin", "wrong")
+
+		_, err := c.ListConnected()
+		if err == nil || !strings.Contains(err.Error(), "provided credentials") {
+			t.Fatalf("expected credentials error, got %v", err)
+		}
+		if stats := f.Stats(); stats.FailedLogins != 1 || stats.HostTables != 0 {
+			t.Errorf("unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("active session", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureSessionActive)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		_, err := c.ListConnected()
+		var e *Error
+		if !errors.Is(err, ErrSessionActive) || !errors.As(err, &e) || e.Code != "MSG_LOGIN_150" {
+			t.Fatalf("expected ErrSessionActive with MSG_LOGIN_150, got %v", err)
+		}
+	})
+
+	t.Run("unknown message", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureUnknownMessage)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret", WithRetry(DefaultRetryPolicy))
+
+		_, err := c.ListConnected()
+		var e *Error
+		if !errors.Is(err, ErrProtocol) || errors.Is(err, ErrBadCredentials) || !errors.As(err, &e) || e.Code != "MSG_LOGIN_99" {
+			t.Fatalf("expected ErrProtocol with MSG_LOGIN_99, got %v", err)
+		}
+		if stats := f.Stats(); stats.FailedLogins != 1 {
+			t.Errorf("expected a single login attempt, got %d", stats.FailedLogins)
+		}
+	})
+
+	t.Run("session left open by another client", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		other, _ := NewHomeStationClient(f.URL, "admin", "secret")
+		if err := other.Login(); err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+		if _, err := c.ListConnected(); err == nil || !strings.Contains(err.Error(), "MSG_LOGIN_150") {
+			t.Fatalf("expected MSG_LOGIN_150 error, got %v", err)
+		}
+
+		other.Close()
+		if _, err := c.ListConnected(); err != nil {
+			t.Fatalf("expected login to succeed after the other client logged out, got %v", err)
+		}
+	})
+
+	t.Run("malformed salt response", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureMalformedSalt)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		_, err := c.ListConnected()
+		if err == nil || !strings.Contains(err.Error(), "salt response") {
+			t.Fatalf("expected salt parsing error, got %v", err)
+		}
+	})
+
+	t.Run("unreachable router", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.Close()
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		if _, err := c.ListConnected(); err == nil || !strings.Contains(err.Error(), "requesting salt") {
+			t.Fatalf("expected network error, got %v", err)
+		}
+	})
+}
+
+func TestHomeStationHostTable(t *testing.T) {
+	t.Run("malformed JSON", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureMalformedHostTable)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		_, err := c.ListConnected()
+		if err == nil || !strings.Contains(err.Error(), "host table JSON") {
+			t.Fatalf("expected parsing error, got %v", err)
+		}
+		// the session must still be closed
+		if f.OpenSessions() != 0 {
+			t.Errorf("expected logout after failed fetch, got %d open sessions", f.OpenSessions())
+		}
+	})
+
+	t.Run("parses active flag", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		devs, err := c.ListConnected()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(devs) != 2 || !devs[0].Active || devs[1].Active {
+			t.Errorf("unexpected devices: %+v", devs)
+		}
+	})
+
+	t.Run("parses optional details", func(t *testing.T) {
+		f := homestationtest.NewServer("admin", "secret", []homestationtest.Host{
+			{
+				MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true,
+				InterfaceType: "802.11", Band: "5G", SSID: "home", RSSI: -58,
+				IPv6: []string{"fe80::1", "2001:db8::1"}, LeaseTime: 3600, ConnectedTime: 120, Vendor: "Apple",
+			},
+			{MAC: "00:11:32:00:00:02", IP: "192.168.0.20", Hostname: "nas", Active: true, InterfaceType: "Ethernet"},
+		})
+		defer f.Close()
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+
+		devs, err := c.ListConnected()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []Device{
+			{
+				MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true,
+				Interface: InterfaceWiFi, Band: "5GHz", SSID: "home", Signal: -58,
+				IPv6: []string{"fe80::1", "2001:db8::1"}, LeaseSeconds: 3600, ConnectedSeconds: 120, Vendor: "Apple",
+				Randomized: true,
+			},
+			// the vendor falls back to the OUI database
+			{MAC: "00:11:32:00:00:02", IP: "192.168.0.20", Hostname: "nas", Active: true, Interface: InterfaceEthernet, Vendor: "Synology Incorporated"},
+		}
+		if !reflect.DeepEqual(devs, want) {
+			t.Errorf("got %+v\nwant %+v", devs, want)
+		}
+	})
+}
+
+// recordingObserver collects observer callbacks
+type recordingObserver struct {
+	logins   int
+	failures []string
+	fetches  []error
+}
+
+func (o *recordingObserver) LoginSucceeded(time.Duration) { o.logins++ }
+func (o *recordingObserver) LoginFailed(_ time.Duration, reason string) {
+	o.failures = append(o.failures, reason)
+}
+func (o *recordingObserver) HostTableFetched(_ time.Duration, err error) {
+	o.fetches = append(o.fetches, err)
+}
+
+func TestHomeStationObserver(t *testing.T) {
+	f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+	o := &recordingObserver{}
+
+	good, _ := NewHomeStationClient(f.URL, "admin", "secret", WithObserver(o))
+	good.ListConnected()
+
+	bad, _ := NewHomeStationClient(f.URL, "admin", "wrong", WithObserver(o))
+	bad.ListConnected()
+
+	f.SetFailure(homestationtest.FailureSessionActive)
+	good.ListConnected()
+
+	if o.logins != 1 {
+		t.Errorf("expected 1 successful login, got %d", o.logins)
+	}
+	want := []string{LoginFailureBadCredentials, LoginFailureSessionActive}
+	if strings.Join(o.failures, ",") != strings.Join(want, ",") {
+		t.Errorf("expected failures %v, got %v", want, o.failures)
+	}
+	if len(o.fetches) != 1 || o.fetches[0] != nil {
+		t.Errorf("expected one successful fetch, got %v", o.fetches)
+	}
+}
+
+func TestHomeStationSessionRenewal(t *testing.T) {
+	f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+	c, _ := NewHomeStationClient(f.URL, "admin", "secret")
+	if err := c.Login(); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	defer c.Close()
+
+	f.ExpireSessions()
+	if _, err := c.ListConnected(); err != nil {
+		t.Fatalf("expected transparent re-login, got %v", err)
+	}
+
+	// a failing renewal is reported, not retried forever
+	f.ExpireSessions()
+	f.SetFailure(homestationtest.FailureSessionActive)
+	_, err := c.ListConnected()
+	if err == nil || !strings.Contains(err.Error(), "renewing session") {
+		t.Fatalf("expected renewal error, got %v", err)
+	}
+}
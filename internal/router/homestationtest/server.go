@@ -0,0 +1,395 @@
+// Package homestationtest provides an in-process emulator of the Vodafone
+// HomeStation web API for tests and demos.
+package homestationtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// sessionCookie is the cookie holding the emulated session id
+const sessionCookie = "PHPSESSID"
+
+// Host is an entry of the emulated host table. Optional details are
+// omitted from the host table when zero, like on routers not reporting
+// them.
+type Host struct {
+	MAC      string
+	IP       string
+	Hostname string
+	Active   bool
+
+	InterfaceType string // "Ethernet" or "802.11"
+	Band          string // "2.4G" or "5G"
+	SSID          string
+	RSSI          int
+	IPv6          []string
+	LeaseTime     int64
+	ConnectedTime int64
+	Vendor        string
+}
+
+// Failure selects a failure mode of the emulator
+type Failure int
+
+const (
+	// FailureNone emulates a healthy router
+	FailureNone Failure = iota
+	// FailureSessionActive rejects every login with MSG_LOGIN_150
+	FailureSessionActive
+	// FailureMalformedSalt answers the salt request with invalid JSON
+	FailureMalformedSalt
+	// FailureMalformedHostTable answers host table requests with invalid JSON
+	FailureMalformedHostTable
+	// FailureUnknownMessage rejects every login with MSG_LOGIN_99, a code
+	// the client doesn't know
+	FailureUnknownMessage
+)
+
+// Fault is a transient error injected with FailNext
+type Fault int
+
+const (
+	// FaultUnavailable answers with 503 Service Unavailable and an HTML
+	// page, like a router that is still booting
+	FaultUnavailable Fault = iota
+	// FaultReset closes the connection without answering
+	FaultReset
+)
+
+// fault is a pending FailNext
+type fault struct {
+	path  string
+	n     int
+	fault Fault
+}
+
+// Stats counts the requests the emulator has handled
+type Stats struct {
+	Logins       int // successful logins
+	FailedLogins int
+	Activations  int // /session/menu calls with a valid session
+	HostTables   int // successful host table requests
+	Logouts      int
+}
+
+// Server emulates the parts of the HomeStation web API used by
+// router.HomeStationClient:
+//
+//   - POST /api/v1/session/login: salt request ("seeksalthash") and login
+//     with the double PBKDF2 hash
+//   - GET  /api/v1/session/menu: activates a freshly logged in session
+//   - GET  /api/v1/host/hostTbl: host table (requires an activated session)
+//   - POST /api/v1/session/logout
+//
+// Like the real router it only allows one session at a time: logging in
+// while another session is open fails with MSG_LOGIN_150.
+type Server struct {
+	*httptest.Server
+
+	user     string
+	password string
+
+	mu        sync.Mutex
+	hosts     []Host
+	failure   Failure
+	delay     time.Duration // before answering host table requests
+	faults    []fault
+	salt      string
+	saltWebUI string
+	sessions  map[string]bool // session id -> activated
+	stats     Stats
+}
+
+// NewServer starts an emulator accepting the given credentials. Call Close
+// when done.
+func NewServer(user, password string, hosts []Host) *Server {
+	return newServer(user, password, hosts, httptest.NewServer)
+}
+
+// NewTLSServer is NewServer serving HTTPS with a self-signed certificate,
+// available as Certificate(), like some firmwares do
+func NewTLSServer(user, password string, hosts []Host) *Server {
+	return newServer(user, password, hosts, httptest.NewTLSServer)
+}
+
+func newServer(user, password string, hosts []Host, start func(http.Handler) *httptest.Server) *Server {
+	s := &Server{
+		user:      user,
+		password:  password,
+		hosts:     hosts,
+		salt:      randomHex(6),
+		saltWebUI: randomHex(6),
+		sessions:  map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/session/login", s.handleLogin)
+	mux.HandleFunc("GET /api/v1/session/menu", s.handleMenu)
+	mux.HandleFunc("GET /api/v1/host/hostTbl", s.handleHostTbl)
+	mux.HandleFunc("POST /api/v1/session/logout", s.handleLogout)
+	s.Server = start(s.injectFaults(mux))
+	return s
+}
+
+// FailNext answers the next n requests to path (all paths if empty) with
+// fault f before handling requests normally again
+func (s *Server) FailNext(path string, n int, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, fault{path: path, n: n, fault: f})
+}
+
+// injectFaults answers requests matching a pending FailNext with its fault
+func (s *Server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		injected, kind := false, FaultUnavailable
+		for i := range s.faults {
+			if f := &s.faults[i]; f.n > 0 && (f.path == "" || f.path == r.URL.Path) {
+				f.n--
+				injected, kind = true, f.fault
+				break
+			}
+		}
+		s.mu.Unlock()
+
+		switch {
+		case !injected:
+			next.ServeHTTP(w, r)
+		case kind == FaultReset:
+			if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+				conn.Close()
+			}
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html><body>Router is starting up</body></html>"))
+		}
+	})
+}
+
+// SetHosts replaces the host table
+func (s *Server) SetHosts(hosts []Host) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts = hosts
+}
+
+// SetFailure switches the emulator into a failure mode
+func (s *Server) SetFailure(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = f
+}
+
+// SetHostTableDelay makes host table requests take d, like a slow or
+// overloaded router
+func (s *Server) SetHostTableDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// ExpireSessions drops all sessions, like a session timeout on the router
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]bool{}
+}
+
+// OpenSessions returns the number of sessions that have not been logged out
+func (s *Server) OpenSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Stats returns request counters
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Hash computes the login hash the router expects for password
+func Hash(password, salt, saltWebUI string) string {
+	hash1 := hex.EncodeToString(pbkdf2.Key([]byte(password), []byte(salt), 1000, 16, sha256.New))
+	return hex.EncodeToString(pbkdf2.Key([]byte(hash1), []byte(saltWebUI), 1000, 16, sha256.New))
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.PostFormValue("password") == "seeksalthash" {
+		if s.failure == FailureMalformedSalt {
+			w.Write([]byte("<html>not json"))
+			return
+		}
+		writeJSON(w, map[string]string{"error": "ok", "salt": s.salt, "saltwebui": s.saltWebUI})
+		return
+	}
+
+	if s.failure == FailureUnknownMessage {
+		s.stats.FailedLogins++
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_LOGIN_99"})
+		return
+	}
+
+	if s.failure == FailureSessionActive || (len(s.sessions) > 0 && !s.ownsSession(r)) {
+		s.stats.FailedLogins++
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_LOGIN_150"})
+		return
+	}
+
+	if r.PostFormValue("username") != s.user || r.PostFormValue("password") != Hash(s.password, s.salt, s.saltWebUI) {
+		s.stats.FailedLogins++
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_LOGIN_1"})
+		return
+	}
+
+	// a logged in client re-authenticating replaces its old session
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		delete(s.sessions, c.Value)
+	}
+	id := randomHex(16)
+	s.sessions[id] = false
+	s.stats.Logins++
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/"})
+	writeJSON(w, map[string]any{"error": "ok", "message": "all good", "data": map[string]string{}})
+}
+
+func (s *Server) handleMenu(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_NOT_LOGGED_IN"})
+		return
+	}
+	if _, ok := s.sessions[c.Value]; !ok {
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_NOT_LOGGED_IN"})
+		return
+	}
+	s.sessions[c.Value] = true
+	s.stats.Activations++
+	writeJSON(w, map[string]string{"error": "ok"})
+}
+
+func (s *Server) handleHostTbl(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.activeSession(r) {
+		writeJSON(w, map[string]string{"error": "error", "message": "MSG_NOT_LOGGED_IN"})
+		return
+	}
+	if s.failure == FailureMalformedHostTable {
+		w.Write([]byte(`{"error":"ok","data":{"hostTbl":[`))
+		return
+	}
+
+	entries := make([]map[string]string, 0, len(s.hosts))
+	for _, h := range s.hosts {
+		e := map[string]string{
+			"physaddress": h.MAC,
+			"ipaddress":   h.IP,
+			"hostname":    h.Hostname,
+			"active":      strconv.FormatBool(h.Active),
+		}
+		optional := map[string]string{
+			"interfacetype": h.InterfaceType,
+			"band":          h.Band,
+			"ssid":          h.SSID,
+			"ipv6address":   strings.Join(h.IPv6, ","),
+			"vendor":        h.Vendor,
+		}
+		if h.RSSI != 0 {
+			optional["rssi"] = strconv.Itoa(h.RSSI)
+		}
+		if h.LeaseTime != 0 {
+			optional["leasetime"] = strconv.FormatInt(h.LeaseTime, 10)
+		}
+		if h.ConnectedTime != 0 {
+			optional["connectedtime"] = strconv.FormatInt(h.ConnectedTime, 10)
+		}
+		for k, v := range optional {
+			if v != "" {
+				e[k] = v
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	s.stats.HostTables++
+	writeJSON(w, map[string]any{
+		"error":   "ok",
+		"message": "all good",
+		"data":    map[string]any{"hostTbl": entries},
+		"token":   randomHex(8),
+	})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if _, ok := s.sessions[c.Value]; ok {
+			delete(s.sessions, c.Value)
+			s.stats.Logouts++
+		}
+	}
+	writeJSON(w, map[string]string{"error": "ok"})
+}
+
+// ownsSession reports whether the request carries a known session cookie
+func (s *Server) ownsSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	_, ok := s.sessions[c.Value]
+	return ok
+}
+
+// activeSession reports whether the request carries an activated session
+func (s *Server) activeSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	return s.sessions[c.Value]
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
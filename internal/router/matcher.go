@@ -0,0 +1,265 @@
+package router
+
+import (
+	"container/list"
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Matcher reports whether a device is selected by a matcher expression
+type Matcher func(Device) bool
+
+// matcherCacheSize bounds the number of compiled matchers MatchDevice keeps
+const matcherCacheSize = 128
+
+// matcherCache holds the most recently used compiled matchers by expression
+// for MatchDevice, evicting the least recently used one when full
+var matcherCache = struct {
+	sync.Mutex
+	order *list.List // of *cachedMatcher, most recently used first
+	byKey map[string]*list.Element
+}{order: list.New(), byKey: map[string]*list.Element{}}
+
+type cachedMatcher struct {
+	expr string
+	m    Matcher
+}
+
+// matcherFields maps the field prefixes of matcher expressions to the
+// device values they match. Signal strength is handled by signalMatcher.
+var matcherFields = map[string]func(Device) []string{
+	"mac":    func(d Device) []string { return []string{d.MAC} },
+	"linked": func(d Device) []string { return append([]string{d.MAC}, d.LinkedMACs...) },
+	"host":   func(d Device) []string { return []string{d.Hostname} },
+	"ip":     func(d Device) []string { return []string{d.IP} },
+	"ipv6":   func(d Device) []string { return d.IPv6 },
+	"iface":  func(d Device) []string { return []string{d.Interface} },
+	"band":   func(d Device) []string { return []string{d.Band} },
+	"ssid":   func(d Device) []string { return []string{d.SSID} },
+	"vendor": func(d Device) []string { return []string{d.Vendor} },
+}
+
+// ParseMatcher compiles a matcher expression. An expression is an optional
+// field prefix followed by a pattern:
+//
+//   - mac:PATTERN matches the MAC address, ignoring case and separators
+//   - linked:PATTERN matches like mac: but also the earlier randomized
+//     addresses in Device.LinkedMACs, which are inferred and may be wrong
+//   - host:PATTERN matches the hostname
+//   - ip:PATTERN and ipv6:PATTERN match the IPv4 and IPv6 addresses; CIDR
+//     ranges (192.168.0.0/24) match all addresses they contain
+//   - iface:, band:, ssid: and vendor: match the interface type
+//     ("ethernet", "wifi"), Wi-Fi band ("5GHz"), SSID and vendor
+//   - signal:CMP compares the Wi-Fi signal strength in dBm, e.g.
+//     "signal:>-65" (also >=, <, <= and =)
+//
+// A pattern is compared for equality unless it is a glob (containing *, ?
+// or [, e.g. "aa:bb:cc:*" for an OUI prefix or "*-phone") or a regular
+// expression enclosed in slashes ("/^alice-/"). Hostnames are compared
+// case-sensitively, other text fields and all globs case-insensitively.
+//
+// Without a prefix, regular expressions match the hostname, CIDR ranges the
+// IPv4 and IPv6 addresses, and equality and globs are tried against MAC,
+// hostname and the IPv4 and IPv6 addresses.
+func ParseMatcher(expr string) (Matcher, error) {
+	field, pattern, ok := strings.Cut(expr, ":")
+	if _, known := matcherFields[field]; !ok || !known && field != "signal" {
+		field, pattern = "", expr
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty matcher %q", expr)
+	}
+
+	var m Matcher
+	var err error
+	switch field {
+	case "signal":
+		m, err = signalMatcher(pattern)
+
+	case "":
+		if isRegexp(pattern) {
+			m, err = fieldMatcher("host", pattern)
+			break
+		}
+		fields := []string{"mac", "host", "ip", "ipv6"}
+		if _, perr := netip.ParsePrefix(pattern); perr == nil {
+			fields = []string{"ip", "ipv6"}
+		}
+		var ms []Matcher
+		for _, f := range fields {
+			var fm Matcher
+			if fm, err = fieldMatcher(f, pattern); err != nil {
+				break
+			}
+			ms = append(ms, fm)
+		}
+		m = func(d Device) bool {
+			for _, fm := range ms {
+				if fm(d) {
+					return true
+				}
+			}
+			return false
+		}
+
+	default:
+		m, err = fieldMatcher(field, pattern)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid matcher %q: %w", expr, err)
+	}
+	return m, nil
+}
+
+// MatcherMAC returns the MAC address if expr selects a single MAC address
+// exactly, e.g. "aa:bb:cc:dd:ee:01" or "mac:aabbccddee01"
+func MatcherMAC(expr string) (string, bool) {
+	field, pattern, ok := strings.Cut(expr, ":")
+	if _, known := matcherFields[field]; !ok || !known && field != "signal" {
+		field, pattern = "", expr
+	}
+	if field != "" && field != "mac" {
+		return "", false
+	}
+	n := NormalizeMAC(pattern)
+	if len(n) != 12 || strings.Trim(n, "0123456789abcdef") != "" {
+		return "", false
+	}
+	return pattern, true
+}
+
+// fieldMatcher matches pattern against the values of one field
+func fieldMatcher(field, pattern string) (Matcher, error) {
+	match, err := valueMatcher(field, pattern)
+	if err != nil {
+		return nil, err
+	}
+	values := matcherFields[field]
+	return func(d Device) bool {
+		for _, v := range values(d) {
+			if v != "" && match(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// valueMatcher compiles pattern into a predicate on a single field value
+func valueMatcher(field, pattern string) (func(string) bool, error) {
+	switch {
+	case isRegexp(pattern):
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+
+	case (field == "ip" || field == "ipv6") && strings.Contains(pattern, "/"):
+		prefix, err := netip.ParsePrefix(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(v string) bool { return inPrefix(prefix, v) }, nil
+
+	case strings.ContainsAny(pattern, "*?["):
+		normalize := strings.ToLower
+		if field == "mac" || field == "linked" {
+			normalize = NormalizeMAC
+		}
+		// NormalizeMAC keeps the wildcards, only separators are dropped
+		glob := normalize(pattern)
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, err
+		}
+		return func(v string) bool {
+			ok, _ := path.Match(glob, normalize(v))
+			return ok
+		}, nil
+	}
+
+	switch field {
+	case "mac", "linked":
+		return func(v string) bool { return MatchMAC(v, pattern) }, nil
+	case "ip", "ipv6":
+		// compare addresses, "2001:DB8::1" is "2001:db8::1"
+		if addr, err := netip.ParseAddr(pattern); err == nil {
+			return func(v string) bool {
+				a, err := netip.ParseAddr(v)
+				return err == nil && a == addr
+			}, nil
+		}
+		return func(v string) bool { return v == pattern }, nil
+	case "host":
+		return func(v string) bool { return v == pattern }, nil
+	case "band":
+		pattern = NormalizeBand(pattern)
+	}
+	return func(v string) bool { return strings.EqualFold(v, pattern) }, nil
+}
+
+// signalMatcher compares the signal strength, e.g. ">-65" or "<=-80".
+// Devices without a known signal strength never match.
+func signalMatcher(pattern string) (Matcher, error) {
+	op := ""
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(pattern, o) {
+			op = o
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(pattern[len(op):]))
+	if err != nil {
+		return nil, fmt.Errorf("signal must be compared to a number of dBm")
+	}
+
+	cmp := map[string]func(int) bool{
+		">=": func(s int) bool { return s >= n },
+		"<=": func(s int) bool { return s <= n },
+		">":  func(s int) bool { return s > n },
+		"<":  func(s int) bool { return s < n },
+		"=":  func(s int) bool { return s == n },
+		"":   func(s int) bool { return s == n },
+	}[op]
+	return func(d Device) bool { return d.Signal != 0 && cmp(d.Signal) }, nil
+}
+
+// isRegexp reports whether pattern is a regular expression in slashes
+func isRegexp(pattern string) bool {
+	return len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// inPrefix reports whether the address addr is inside prefix
+func inPrefix(prefix netip.Prefix, addr string) bool {
+	a, err := netip.ParseAddr(addr)
+	return err == nil && prefix.Contains(a)
+}
+
+// compiledMatcher returns the cached Matcher for expr. Invalid expressions
+// fall back to plain equality so that they still match literally.
+func compiledMatcher(expr string) Matcher {
+	c := &matcherCache
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.byKey[expr]; ok {
+		c.order.MoveToFront(e)
+		return e.Value.(*cachedMatcher).m
+	}
+
+	m, err := ParseMatcher(expr)
+	if err != nil {
+		m = func(d Device) bool { return MatchMAC(d.MAC, expr) || d.Hostname == expr || d.IP == expr }
+	}
+	c.byKey[expr] = c.order.PushFront(&cachedMatcher{expr, m})
+	if c.order.Len() > matcherCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byKey, oldest.Value.(*cachedMatcher).expr)
+	}
+	return m
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseMatcher(t *testing.T) {
+	phone := Device{
+		MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "Alice-Phone",
+		Interface: InterfaceWiFi, Band: "5GHz", SSID: "home-5g", Signal: -58, IPv6: []string{"fe80::1", "2001:db8::1"}, Vendor: "Apple",
+	}
+	tv := Device{MAC: "02:00:5E:10:00:04", IP: "10.0.0.7", Hostname: "living-room-tv", Interface: InterfaceEthernet}
+
+	tests := []struct {
+		expr      string
+		phone, tv bool
+	}{
+		// plain values keep matching any field exactly
+		{"aa-bb-cc-dd-ee-01", true, false},
+		{"Alice-Phone", true, false},
+		{"alice-phone", false, false},
+		{"10.0.0.7", false, true},
+
+		// globs
+		{"aa:bb:cc:*", true, false},
+		{"*-phone", true, false},
+		{"192.168.0.*", true, false},
+		{"living-room-?v", false, true},
+
+		// regular expressions match hostnames unless prefixed
+		{"/^alice-/", false, false},
+		{"/(?i)^alice-/", true, false},
+		{"/room/", false, true},
+		{"ip:/^10\\./", false, true},
+
+		// CIDR ranges
+		{"192.168.0.0/24", true, false},
+		{"ip:10.0.0.0/8", false, true},
+		{"fe80::/10", true, false},
+		{"2001:db8::/32", true, false},
+
+		// IPv6 addresses without a prefix
+		{"2001:db8::1", true, false},
+		{"2001:DB8:0::1", true, false},
+		{"fe80::2", false, false},
+		{"fe80::*", true, false},
+
+		// field prefixes restrict matching to one field
+		{"host:Alice-Phone", true, false},
+		{"host:aa:bb:cc:dd:ee:01", false, false},
+		{"mac:aabbccddee01", true, false},
+		{"mac:02:00:5e:*", false, true},
+		{"ip:192.168.0.10", true, false},
+		{"mac:192.168.0.10", false, false},
+
+		// optional details
+		{"band:5GHz", true, false},
+		{"band:5g", true, false},
+		{"iface:wifi", true, false},
+		{"iface:ethernet", false, true},
+		{"ssid:/^home/", true, false},
+		{"vendor:apple*", true, false},
+		{"ipv6:2001:db8::/32", true, false},
+		{"ipv6:fe80::1", true, false},
+		{"signal:>-65", true, false},
+		{"signal:<=-70", false, false},
+		{"signal:-58", true, false},
+	}
+	for _, tt := range tests {
+		m, err := ParseMatcher(tt.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := m(phone); got != tt.phone {
+			t.Errorf("%s: phone matched = %v, want %v", tt.expr, got, tt.phone)
+		}
+		if got := m(tv); got != tt.tv {
+			t.Errorf("%s: tv matched = %v, want %v", tt.expr, got, tt.tv)
+		}
+	}
+}
+
+func TestParseMatcherErrors(t *testing.T) {
+	for _, expr := range []string{"", "host:", "/(/", "ip:10.0.0.0/33", "phone-[", "mac:[a", "signal:strong", "signal:>"} {
+		if _, err := ParseMatcher(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestMatchDeviceInvalidExpression(t *testing.T) {
+	odd := Device{MAC: "AA:BB:CC:DD:EE:09", Hostname: "phone-["}
+	if !MatchDevice(odd, "phone-[") {
+		t.Error("expected invalid expressions to match literally")
+	}
+}
+
+func TestMatcherCacheIsBounded(t *testing.T) {
+	d := Device{MAC: "AA:BB:CC:DD:EE:01", Hostname: "phone"}
+	for i := range 3 * matcherCacheSize {
+		MatchDevice(d, fmt.Sprintf("host:phone-%d", i))
+	}
+	if !MatchDevice(d, "phone") {
+		t.Error("expected phone to match")
+	}
+	if n := matcherCache.order.Len(); n != matcherCacheSize || len(matcherCache.byKey) != n {
+		t.Errorf("expected %d cached matchers, got %d (%d keys)", matcherCacheSize, n, len(matcherCache.byKey))
+	}
+}
+
+func TestLinkedMACs(t *testing.T) {
+	rotated := Device{MAC: "DA:A1:19:00:00:02", Hostname: "alice-phone", LinkedMACs: []string{"DA:A1:19:00:00:01"}}
+	for expr, want := range map[string]bool{
+		"da:a1:19:00:00:01":        false,
+		"mac:daa119000001":         false,
+		"linked:daa119000001":      true,
+		"linked:da:a1:19:00:00:02": true,
+		"linked:DA:A1:19:*":        true,
+		"host:da:a1:19:00:00:01":   false,
+		"linked:da:a1:19:00:00:03": false,
+	} {
+		if got := MatchDevice(rotated, expr); got != want {
+			t.Errorf("%s: matched = %t, want %t", expr, got, want)
+		}
+	}
+}
+
+func TestMatcherMAC(t *testing.T) {
+	for expr, want := range map[string]string{
+		"aa:bb:cc:dd:ee:01": "aa:bb:cc:dd:ee:01",
+		"mac:aabbccddee01":  "aabbccddee01",
+		"mac:aa:bb:cc:*":    "",
+		"host:aabbccddee01": "",
+		"alice-phone":       "",
+		"192.168.0.10":      "",
+		"aa-bb-cc-dd-ee-0g": "",
+	} {
+		if got, _ := MatcherMAC(expr); got != want {
+			t.Errorf("MatcherMAC(%q) = %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestNormalizeBand(t *testing.T) {
+	for in, want := range map[string]string{"2.4G": "2.4GHz", "5G": "5GHz", "5 GHz": "5GHz", "6ghz": "6GHz", "60GHz": "60GHz"} {
+		if got := NormalizeBand(in); got != want {
+			t.Errorf("NormalizeBand(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package router
+
+import "time"
+
+// Reasons passed to Observer.LoginFailed
+const (
+	LoginFailureNetwork        = "network"
+	LoginFailureProtocol       = "protocol"
+	LoginFailureBadCredentials = "bad_credentials"
+	LoginFailureSessionActive  = "session_active" // MSG_LOGIN_150
+	LoginFailureCertificate    = "certificate"
+	LoginFailureUnknown        = "unknown"
+)
+
+// Observer receives timing and failure information from a router client,
+// e.g. to export metrics
+type Observer interface {
+	LoginSucceeded(d time.Duration)
+	LoginFailed(d time.Duration, reason string)
+	HostTableFetched(d time.Duration, err error)
+}
+
+// nopObserver is used when no Observer is configured
+type nopObserver struct{}
+
+func (nopObserver) LoginSucceeded(time.Duration)          {}
+func (nopObserver) LoginFailed(time.Duration, string)     {}
+func (nopObserver) HostTableFetched(time.Duration, error) {}
@@ -0,0 +1,641 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nullSession is the ubus session id used before logging in
+const nullSession = "00000000000000000000000000000000"
+
+// ubus status codes (see ubusd's enum ubus_msg_status)
+const (
+	ubusStatusOK               = 0
+	ubusStatusMethodNotFound   = 3
+	ubusStatusNotFound         = 4
+	ubusStatusPermissionDenied = 6
+)
+
+// OpenWrtClient implements RouterClient for OpenWrt routers using the ubus
+// JSON-RPC endpoint of LuCI (/ubus). Devices are taken from luci-rpc's host
+// hints (every host the router knows about). A device is active while it is
+// associated with one of the router's access points (iwinfo) or reachable in
+// its ARP/NDP neighbour table (ip neigh, run through rpcd's file object).
+// Only where the session can't use those, holding a DHCP lease counts as
+// active instead, which a device keeps for hours after leaving.
+type OpenWrtClient struct {
+	baseURL  string
+	user     string
+	pass     string
+	client   *http.Client
+	timeouts Timeouts
+	retry    RetryPolicy
+	observer Observer
+	logger   *slog.Logger
+	sessions *SessionStore
+
+	mu          sync.Mutex
+	session     string
+	keepSession bool
+	nextID      int
+	// sessionPID is the process whose recorded session is in session, 0
+	// if it isn't recorded
+	sessionPID int
+}
+
+func init() {
+	Register("openwrt", func(cfg Config) (RouterClient, error) {
+		return NewOpenWrtClient(cfg)
+	})
+}
+
+// NewOpenWrtClient creates a client for the LuCI ubus endpoint at cfg.BaseURL
+func NewOpenWrtClient(cfg Config) (*OpenWrtClient, error) {
+	var observer Observer = nopObserver{}
+	if cfg.Observer != nil {
+		observer = cfg.Observer
+	}
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	logger := discardLogger(cfg.Logger).With("router", baseURL)
+	transport, err := newTransport(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: transport}
+	if cfg.Trace {
+		client.Transport = newTraceTransport(transport, logger)
+	}
+	return &OpenWrtClient{
+		baseURL:  baseURL,
+		user:     cfg.User,
+		pass:     cfg.Pass,
+		client:   client,
+		timeouts: cfg.Timeouts.orDefault(cfg.Timeout),
+		retry:    cfg.Retry,
+		observer: observer,
+		logger:   logger,
+		sessions: cfg.Sessions,
+	}, nil
+}
+
+// ubusError is a non-zero ubus status or a JSON-RPC error
+type ubusError struct {
+	code    int
+	message string
+}
+
+func (e *ubusError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("ubus error %d: %s", e.code, e.message)
+	}
+	return fmt.Sprintf("ubus status %d", e.code)
+}
+
+// sessionRejected reports whether err means the ubus session is not (or no
+// longer) valid
+func sessionRejected(err error) bool {
+	var ue *ubusError
+	// -32002 is the JSON-RPC "Access denied" error returned for unknown sessions
+	return errors.As(err, &ue) && (ue.code == ubusStatusPermissionDenied || ue.code == -32002)
+}
+
+// call invokes a ubus method and decodes the result object into out
+func (o *OpenWrtClient) call(ctx context.Context, session, object, method string, args any, out any) error {
+	if args == nil {
+		args = map[string]any{}
+	}
+	o.nextID++
+	reqBody, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      o.nextID,
+		"method":  "call",
+		"params":  []any{session, object, method, args},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/ubus", bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return &Error{Kind: ErrUnreachable, Err: err}
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return &Error{Kind: ErrUnreachable, Err: &statusError{code: resp.StatusCode}}
+	}
+
+	var r struct {
+		Result []json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return &Error{Kind: ErrProtocol, Err: fmt.Errorf("failed parsing ubus response: %w", err)}
+	}
+	if r.Error != nil {
+		return &Error{Kind: ErrProtocol, Code: strconv.Itoa(r.Error.Code), Err: &ubusError{code: r.Error.Code, message: r.Error.Message}}
+	}
+	if len(r.Result) == 0 {
+		return &Error{Kind: ErrProtocol, Err: errors.New("empty ubus result")}
+	}
+
+	var status int
+	if err := json.Unmarshal(r.Result[0], &status); err != nil {
+		return &Error{Kind: ErrProtocol, Err: fmt.Errorf("failed parsing ubus status: %w", err)}
+	}
+	if status != ubusStatusOK {
+		return &Error{Kind: ErrProtocol, Code: strconv.Itoa(status), Err: &ubusError{code: status}}
+	}
+	if out == nil {
+		return nil
+	}
+	if len(r.Result) < 2 {
+		return &Error{Kind: ErrProtocol, Err: errors.New("ubus result without data")}
+	}
+	if err := json.Unmarshal(r.Result[1], out); err != nil {
+		return &Error{Kind: ErrProtocol, Err: fmt.Errorf("failed parsing ubus data: %w", err)}
+	}
+	return nil
+}
+
+// login creates a new ubus session, first destroying a stale session
+// recorded by an earlier run, and retries it according to the retry policy
+func (o *OpenWrtClient) login(ctx context.Context) error {
+	o.endStaleSession(ctx)
+	return o.retry.do(ctx, o.logger, "login", func() error {
+		return o.tryLogin(ctx)
+	})
+}
+
+// tryLogin creates a new ubus session
+func (o *OpenWrtClient) tryLogin(ctx context.Context) (err error) {
+	start := time.Now()
+	o.logger.Debug("logging in", "user", o.user)
+	defer func() {
+		if err == nil {
+			o.logger.Debug("logged in", "duration", time.Since(start))
+			o.observer.LoginSucceeded(time.Since(start))
+			return
+		}
+		reason := loginFailureReason(err)
+		o.logger.Warn("login failed", "reason", reason, "duration", time.Since(start), "error", err)
+		o.observer.LoginFailed(time.Since(start), reason)
+	}()
+
+	var res struct {
+		Session string `json:"ubus_rpc_session"`
+	}
+	args := map[string]string{"username": o.user, "password": o.pass}
+	ctx, cancel := context.WithTimeout(ctx, o.timeouts.Login)
+	defer cancel()
+	if err := o.call(ctx, nullSession, "session", "login", args, &res); err != nil {
+		if sessionRejected(err) {
+			var e *Error
+			errors.As(err, &e)
+			return &Error{Kind: ErrBadCredentials, Code: e.Code}
+		}
+		return fmt.Errorf("failed logging in: %w", err)
+	}
+	if res.Session == "" {
+		return &Error{Kind: ErrProtocol, Err: errors.New("no session returned from router")}
+	}
+	o.session = res.Session
+	o.recordSession()
+	return nil
+}
+
+// logout destroys the current ubus session. It is attempted even if ctx is
+// already cancelled, limited by the logout timeout.
+func (o *OpenWrtClient) logout(ctx context.Context) error {
+	if o.session == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.timeouts.Logout)
+	defer cancel()
+	err := o.call(ctx, o.session, "session", "destroy", nil, nil)
+	o.session = ""
+	if err != nil && !sessionRejected(err) {
+		// keep the recorded session, the next run tries again
+		o.logger.Warn("logout failed", "error", err)
+		return err
+	}
+	o.logger.Debug("logged out")
+	o.forgetSession()
+	return nil
+}
+
+// ResetSession implements SessionResetter
+func (o *OpenWrtClient) ResetSession(ctx context.Context, force bool) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.sessions == nil {
+		return false, nil
+	}
+	sessions, err := o.sessions.Sessions(o.sessionKey())
+	if err != nil {
+		return false, err
+	}
+	reset, inUse := false, 0
+	for _, sess := range sessions {
+		if !force && !sess.Stale() {
+			inUse = sess.PID
+			continue
+		}
+		o.session, o.sessionPID = sess.ID, sess.PID
+		if err := o.logout(ctx); err != nil {
+			o.sessionPID = 0
+			return reset, fmt.Errorf("failed logging out: %w", err)
+		}
+		reset = true
+	}
+	if !reset && inUse != 0 {
+		return false, fmt.Errorf("%w by process %d", ErrSessionInUse, inUse)
+	}
+	o.keepSession = false
+	return reset, nil
+}
+
+func (o *OpenWrtClient) sessionKey() string {
+	return SessionKey(o.user, o.baseURL)
+}
+
+// recordSession records the ubus session in the session store
+func (o *OpenWrtClient) recordSession() {
+	if o.sessions == nil {
+		return
+	}
+	sess := Session{ID: o.session, PID: os.Getpid(), Started: time.Now()}
+	if err := o.sessions.Put(o.sessionKey(), sess); err != nil {
+		o.logger.Warn("failed recording session", "error", err)
+		return
+	}
+	o.sessionPID = sess.PID
+}
+
+// forgetSession removes the recorded session that was just logged out from
+// the session store. Sessions of other processes are kept.
+func (o *OpenWrtClient) forgetSession() {
+	if o.sessions == nil || o.sessionPID == 0 {
+		return
+	}
+	if err := o.sessions.Remove(o.sessionKey(), o.sessionPID); err != nil {
+		o.logger.Warn("failed forgetting session", "error", err)
+	}
+	o.sessionPID = 0
+}
+
+// endStaleSession destroys a session recorded by a process that is gone
+// without logging out. OpenWrt allows several sessions, but each one keeps
+// holding memory on the router until it times out.
+func (o *OpenWrtClient) endStaleSession(ctx context.Context) {
+	if o.sessions == nil {
+		return
+	}
+	sessions, err := o.sessions.Sessions(o.sessionKey())
+	if err != nil {
+		o.logger.Warn("failed reading recorded sessions", "error", err)
+		return
+	}
+	for _, sess := range sessions {
+		if !sess.Stale() {
+			continue
+		}
+		o.logger.Info("logging out stale session", "pid", sess.PID, "started", sess.Started)
+		o.session, o.sessionPID = sess.ID, sess.PID
+		o.logout(ctx)
+	}
+	// a session that couldn't be logged out stays recorded for the next run
+	o.sessionPID = 0
+}
+
+type hostHint struct {
+	IPAddrs  []string `json:"ipaddrs"`
+	IP6Addrs []string `json:"ip6addrs"`
+	Name     string   `json:"name"`
+}
+
+type dhcpLeases struct {
+	Leases []struct {
+		MACAddr  string `json:"macaddr"`
+		IPAddr   string `json:"ipaddr"`
+		Hostname string `json:"hostname"`
+		Expires  int64  `json:"expires"` // seconds, -1 for static leases
+	} `json:"dhcp_leases"`
+}
+
+type iwinfoDevices struct {
+	Devices []string `json:"devices"`
+}
+
+type iwinfoInfo struct {
+	SSID      string `json:"ssid"`
+	Frequency int    `json:"frequency"` // MHz
+}
+
+type iwinfoAssocList struct {
+	Results []struct {
+		MAC    string `json:"mac"`
+		Signal int    `json:"signal"`
+	} `json:"results"`
+}
+
+// association is a Wi-Fi client associated with one of the router's access
+// points
+type association struct {
+	mac    string
+	ssid   string
+	band   string
+	signal int
+}
+
+// sourceUnavailable reports whether err means the router doesn't offer an
+// optional ubus object or method, or the session's ACL doesn't allow it
+func sourceUnavailable(err error) bool {
+	var ue *ubusError
+	return errors.As(err, &ue) && ue.code != -32002
+}
+
+// frequencyBand returns the Wi-Fi band of a channel frequency in MHz
+func frequencyBand(mhz int) string {
+	switch {
+	case mhz <= 0:
+		return ""
+	case mhz < 3000:
+		return "2.4GHz"
+	case mhz < 5950:
+		return "5GHz"
+	}
+	return "6GHz"
+}
+
+// fetchAssociations returns the clients associated with the router's access
+// points by normalized MAC, or nil if iwinfo is unavailable
+func (o *OpenWrtClient) fetchAssociations(ctx context.Context) (map[string]association, error) {
+	var devices iwinfoDevices
+	if err := o.call(ctx, o.session, "iwinfo", "devices", nil, &devices); err != nil {
+		if sourceUnavailable(err) {
+			o.logger.Debug("Wi-Fi associations unavailable", "error", err)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	assoc := map[string]association{}
+	for _, dev := range devices.Devices {
+		args := map[string]string{"device": dev}
+		var info iwinfoInfo
+		var list iwinfoAssocList
+		err := o.call(ctx, o.session, "iwinfo", "info", args, &info)
+		if err == nil {
+			err = o.call(ctx, o.session, "iwinfo", "assoclist", args, &list)
+		}
+		if err != nil {
+			if sourceUnavailable(err) {
+				o.logger.Debug("Wi-Fi associations unavailable", "device", dev, "error", err)
+				return nil, nil
+			}
+			return nil, err
+		}
+		for _, c := range list.Results {
+			assoc[NormalizeMAC(c.MAC)] = association{mac: c.MAC, ssid: info.SSID, band: frequencyBand(info.Frequency), signal: c.Signal}
+		}
+	}
+	return assoc, nil
+}
+
+// neighbourPresent reports whether a neighbour table state means the host
+// answered recently. STALE entries linger for a while after a host is gone.
+func neighbourPresent(state string) bool {
+	switch state {
+	case "REACHABLE", "DELAY", "PROBE", "PERMANENT":
+		return true
+	}
+	return false
+}
+
+// fetchNeighbours returns whether each host in the router's ARP and NDP
+// neighbour tables is reachable by normalized MAC, or nil if the table is
+// unavailable
+func (o *OpenWrtClient) fetchNeighbours(ctx context.Context) (map[string]bool, error) {
+	var res struct {
+		Code   int    `json:"code"`
+		Stdout string `json:"stdout"`
+	}
+	args := map[string]any{"command": "/sbin/ip", "params": []string{"neigh", "show"}}
+	if err := o.call(ctx, o.session, "file", "exec", args, &res); err != nil {
+		if sourceUnavailable(err) {
+			o.logger.Debug("neighbour table unavailable", "error", err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if res.Code != 0 {
+		o.logger.Debug("neighbour table unavailable", "exit_code", res.Code)
+		return nil, nil
+	}
+
+	// e.g. "192.168.1.10 dev br-lan lladdr aa:bb:cc:dd:ee:10 REACHABLE"
+	reachable := map[string]bool{}
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "lladdr" {
+				key := NormalizeMAC(fields[i+1])
+				reachable[key] = reachable[key] || neighbourPresent(fields[len(fields)-1])
+				break
+			}
+		}
+	}
+	return reachable, nil
+}
+
+// fetchDevices merges host hints, DHCP leases, Wi-Fi associations and the
+// neighbour table into a device list sorted by MAC
+func (o *OpenWrtClient) fetchDevices(ctx context.Context) (devs []Device, err error) {
+	start := time.Now()
+	defer func() {
+		o.observer.HostTableFetched(time.Since(start), err)
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeouts.Table)
+	defer cancel()
+	var hints map[string]hostHint
+	if err := o.call(ctx, o.session, "luci-rpc", "getHostHints", nil, &hints); err != nil {
+		return nil, fmt.Errorf("failed fetching host hints: %w", err)
+	}
+	var leases dhcpLeases
+	if err := o.call(ctx, o.session, "luci-rpc", "getDHCPLeases", nil, &leases); err != nil {
+		return nil, fmt.Errorf("failed fetching DHCP leases: %w", err)
+	}
+	assoc, err := o.fetchAssociations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching Wi-Fi associations: %w", err)
+	}
+	neighbours, err := o.fetchNeighbours(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching neighbour table: %w", err)
+	}
+
+	byMAC := map[string]*Device{}
+	device := func(mac string) *Device {
+		key := NormalizeMAC(mac)
+		d, ok := byMAC[key]
+		if !ok {
+			d = &Device{MAC: strings.ToUpper(mac)}
+			byMAC[key] = d
+		}
+		return d
+	}
+	for mac, h := range hints {
+		d := device(mac)
+		d.Hostname, d.IPv6 = h.Name, h.IP6Addrs
+		if len(h.IPAddrs) > 0 {
+			d.IP = h.IPAddrs[0]
+		}
+	}
+	leased := map[string]bool{}
+	for _, l := range leases.Leases {
+		d := device(l.MACAddr)
+		leased[NormalizeMAC(l.MACAddr)] = true
+		if l.IPAddr != "" {
+			d.IP = l.IPAddr
+		}
+		if l.Hostname != "" {
+			d.Hostname = l.Hostname
+		}
+		if l.Expires > 0 {
+			d.LeaseSeconds = l.Expires
+		}
+	}
+	for _, a := range assoc {
+		d := device(a.mac)
+		d.Interface, d.SSID, d.Band, d.Signal = InterfaceWiFi, a.ssid, a.band, a.signal
+	}
+
+	for key, d := range byMAC {
+		_, associated := assoc[key]
+		switch {
+		case associated:
+			d.Active = true
+		case neighbours != nil:
+			d.Active = neighbours[key]
+		default:
+			// without the neighbour table, a lease is all there is to go
+			// by for wired devices
+			d.Active = leased[key]
+		}
+	}
+
+	out := make([]Device, 0, len(byMAC))
+	for _, d := range byMAC {
+		out = append(out, identify(*d))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	o.logger.Debug("fetched host table", "devices", len(out), "wifi", assoc != nil, "neighbours", neighbours != nil, "duration", time.Since(start))
+	return out, nil
+}
+
+// fetch fetches the devices, retrying transient errors
+func (o *OpenWrtClient) fetch(ctx context.Context) (devs []Device, err error) {
+	err = o.retry.do(ctx, o.logger, "host table", func() error {
+		devs, err = o.fetchDevices(ctx)
+		return err
+	})
+	return devs, err
+}
+
+// ListConnected returns all known devices. Without an open session it logs
+// in and out around the request; with a session opened by Login the session
+// is reused and renewed once if the router rejects it.
+func (o *OpenWrtClient) ListConnected() ([]Device, error) {
+	return o.ListConnectedContext(context.Background())
+}
+
+// ListConnectedContext is ListConnected with cancellation. If ctx is
+// cancelled while fetching the devices, the client still logs out before
+// returning ctx's error.
+func (o *OpenWrtClient) ListConnectedContext(ctx context.Context) ([]Device, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.keepSession {
+		if err := o.login(ctx); err != nil {
+			return nil, err
+		}
+		defer o.logout(ctx)
+		return o.fetch(ctx)
+	}
+
+	if o.session == "" {
+		if err := o.login(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	devs, err := o.fetch(ctx)
+	if !sessionRejected(err) {
+		return devs, err
+	}
+
+	o.logger.Info("session expired, logging in again", "error", err)
+	o.session = ""
+	if err := o.login(ctx); err != nil {
+		return nil, fmt.Errorf("failed renewing session: %w", err)
+	}
+	return o.fetch(ctx)
+}
+
+// Login opens a session that is kept alive across ListConnected calls
+// until Close is called
+func (o *OpenWrtClient) Login() error {
+	return o.LoginContext(context.Background())
+}
+
+// LoginContext is Login with cancellation
+func (o *OpenWrtClient) LoginContext(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.session != "" {
+		return nil
+	}
+	if err := o.login(ctx); err != nil {
+		return err
+	}
+	o.keepSession = true
+	return nil
+}
+
+// Close destroys a session opened by Login
+func (o *OpenWrtClient) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.logout(context.Background())
+	o.keepSession = false
+	return nil
+}
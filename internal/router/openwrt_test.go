@@ -0,0 +1,274 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUbus emulates the LuCI ubus JSON-RPC endpoint of an OpenWrt router.
+// Active devices with Interface wifi are associated with its access point,
+// all active devices are reachable neighbours and hold a DHCP lease, as do
+// inactive devices with LeaseSeconds set.
+type fakeUbus struct {
+	*httptest.Server
+	user, pass string
+	devices    []Device
+	// noWireless and noNeighbours deny the session access to iwinfo and
+	// to running ip neigh
+	noWireless, noNeighbours bool
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	logins   int
+	logouts  int
+	delay    time.Duration // before answering luci-rpc calls
+	failures int           // requests still to answer with 503
+}
+
+func newFakeUbus(t *testing.T, user, pass string, devices []Device) *fakeUbus {
+	f := &fakeUbus{user: user, pass: pass, devices: devices, sessions: map[string]bool{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeUbus) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ubus" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		ID     int               `json:"id"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Params) != 4 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var session, object, method string
+	json.Unmarshal(req.Params[0], &session)
+	json.Unmarshal(req.Params[1], &object)
+	json.Unmarshal(req.Params[2], &method)
+
+	reply := func(result ...any) {
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+
+	f.mu.Lock()
+	delay := f.delay
+	fail := f.failures > 0
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+	if fail {
+		http.Error(w, "starting up", http.StatusServiceUnavailable)
+		return
+	}
+	if object == "luci-rpc" {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if object == "session" && method == "login" {
+		var args map[string]string
+		json.Unmarshal(req.Params[3], &args)
+		if args["username"] != f.user || args["password"] != f.pass {
+			reply(ubusStatusPermissionDenied)
+			return
+		}
+		f.logins++
+		sid := fmt.Sprintf("%032d", f.logins)
+		f.sessions[sid] = true
+		reply(ubusStatusOK, map[string]any{"ubus_rpc_session": sid, "timeout": 300})
+		return
+	}
+
+	if !f.sessions[session] {
+		json.NewEncoder(w).Encode(map[string]any{
+			"jsonrpc": "2.0", "id": req.ID,
+			"error": map[string]any{"code": -32002, "message": "Access denied"},
+		})
+		return
+	}
+
+	switch object + "." + method {
+	case "session.destroy":
+		delete(f.sessions, session)
+		f.logouts++
+		reply(ubusStatusOK)
+
+	case "luci-rpc.getHostHints":
+		hints := map[string]any{}
+		for _, d := range f.devices {
+			hints[d.MAC] = map[string]any{"ipaddrs": []string{d.IP}, "ip6addrs": d.IPv6, "name": d.Hostname}
+		}
+		reply(ubusStatusOK, hints)
+
+	case "luci-rpc.getDHCPLeases":
+		leases := []any{}
+		for _, d := range f.devices {
+			if d.Active || d.LeaseSeconds > 0 {
+				expires := d.LeaseSeconds
+				if expires == 0 {
+					expires = 3600
+				}
+				leases = append(leases, map[string]any{"macaddr": d.MAC, "ipaddr": d.IP, "hostname": d.Hostname, "expires": expires})
+			}
+		}
+		reply(ubusStatusOK, map[string]any{"dhcp_leases": leases})
+
+	case "iwinfo.devices", "iwinfo.info", "iwinfo.assoclist":
+		if f.noWireless {
+			reply(ubusStatusPermissionDenied)
+			return
+		}
+		var args map[string]string
+		json.Unmarshal(req.Params[3], &args)
+		switch {
+		case method == "devices":
+			reply(ubusStatusOK, map[string]any{"devices": []string{"phy0-ap0"}})
+		case args["device"] != "phy0-ap0":
+			reply(ubusStatusNotFound)
+		case method == "info":
+			reply(ubusStatusOK, map[string]any{"ssid": "home", "frequency": 5180})
+		default:
+			results := []any{}
+			for _, d := range f.devices {
+				if d.Active && d.Interface == InterfaceWiFi {
+					results = append(results, map[string]any{"mac": d.MAC, "signal": d.Signal})
+				}
+			}
+			reply(ubusStatusOK, map[string]any{"results": results})
+		}
+
+	case "file.exec":
+		if f.noNeighbours {
+			reply(ubusStatusPermissionDenied)
+			return
+		}
+		var out strings.Builder
+		for _, d := range f.devices {
+			state := "STALE"
+			if d.Active {
+				state = "REACHABLE"
+			}
+			fmt.Fprintf(&out, "%s dev br-lan lladdr %s %s\n", d.IP, strings.ToLower(d.MAC), state)
+		}
+		out.WriteString("192.168.1.254 dev br-lan  FAILED\n")
+		reply(ubusStatusOK, map[string]any{"code": 0, "stdout": out.String()})
+
+	default:
+		reply(ubusStatusMethodNotFound)
+	}
+}
+
+func (f *fakeUbus) stats() (logins, logouts int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins, f.logouts
+}
+
+func (f *fakeUbus) delayTable(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delay = d
+}
+
+func (f *fakeUbus) failNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = n
+}
+
+// expireSessions forgets all sessions, as a router reboot or timeout would
+func (f *fakeUbus) expireSessions() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = map[string]bool{}
+}
+
+func TestOpenWrtUsesLeaseDetails(t *testing.T) {
+	f := newFakeUbus(t, "root", "secret", []Device{
+		{MAC: "aa:bb:cc:dd:ee:10", IP: "192.168.1.10", Hostname: "tv", Active: true, IPv6: []string{"fd00::10"}},
+		{MAC: "aa:bb:cc:dd:ee:11", IP: "192.168.1.11", Hostname: "printer", Active: false},
+	})
+
+	c, _ := NewOpenWrtClient(Config{BaseURL: f.URL, User: "root", Pass: "secret"})
+	devs, err := c.ListConnected()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Device{
+		{MAC: "AA:BB:CC:DD:EE:10", IP: "192.168.1.10", Hostname: "tv", Active: true, IPv6: []string{"fd00::10"}, LeaseSeconds: 3600, Randomized: true},
+		{MAC: "AA:BB:CC:DD:EE:11", IP: "192.168.1.11", Hostname: "printer", Active: false, Randomized: true},
+	}
+	if !reflect.DeepEqual(devs, want) {
+		t.Errorf("got %+v, want %+v", devs, want)
+	}
+}
+
+func TestOpenWrtPresence(t *testing.T) {
+	devices := []Device{
+		{MAC: "00:1B:63:00:00:01", IP: "192.168.1.10", Hostname: "phone", Active: true, Interface: InterfaceWiFi, Signal: -55},
+		{MAC: "00:1B:63:00:00:02", IP: "192.168.1.20", Hostname: "desktop", Active: true},
+		// left an hour ago, its lease hasn't run out yet
+		{MAC: "00:1B:63:00:00:03", IP: "192.168.1.30", Hostname: "tablet", Active: false, LeaseSeconds: 1800},
+	}
+
+	for name, tc := range map[string]struct {
+		noWireless, noNeighbours bool
+		want                     []bool
+	}{
+		"associations and neighbours": {false, false, []bool{true, true, false}},
+		"associations only":           {false, true, []bool{true, true, true}},
+		"neighbours only":             {true, false, []bool{true, true, false}},
+		"falls back to leases":        {true, true, []bool{true, true, true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeUbus(t, "root", "secret", devices)
+			f.noWireless, f.noNeighbours = tc.noWireless, tc.noNeighbours
+
+			c, _ := NewOpenWrtClient(Config{BaseURL: f.URL, User: "root", Pass: "secret"})
+			devs, err := c.ListConnected()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(devs) != len(devices) {
+				t.Fatalf("got %+v", devs)
+			}
+			for i, d := range devs {
+				if d.Active != tc.want[i] {
+					t.Errorf("%s: got active %v, want %v", d.Hostname, d.Active, tc.want[i])
+				}
+			}
+			if devs[2].LeaseSeconds != 1800 {
+				t.Errorf("expected the tablet's lease details, got %+v", devs[2])
+			}
+
+			phone := devs[0]
+			if tc.noWireless {
+				if phone.Interface != "" {
+					t.Errorf("expected no Wi-Fi details without iwinfo, got %+v", phone)
+				}
+			} else if phone.Interface != InterfaceWiFi || phone.SSID != "home" || phone.Band != "5GHz" || phone.Signal != -55 {
+				t.Errorf("expected the phone's Wi-Fi details, got %+v", phone)
+			}
+		})
+	}
+}
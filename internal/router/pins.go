@@ -0,0 +1,137 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PinStore records the certificate fingerprints of HTTPS routers trusted on
+// first use, one "host fingerprint" line per router like SSH's known_hosts
+// (or "host system" for a router the system trusts, see SystemTrusted).
+// A router whose certificate changed has to be removed from the file (or
+// pinned explicitly) before it is trusted again.
+type PinStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// SystemTrusted is recorded in a PinStore instead of a fingerprint for a
+// router whose certificate the system's roots trust, so that it isn't
+// probed again on every run
+const SystemTrusted = "system"
+
+// NewPinStore returns a PinStore for path. The file is created when the
+// first fingerprint is recorded.
+func NewPinStore(path string) *PinStore {
+	return &PinStore{path: path}
+}
+
+// Path returns the file the fingerprints are recorded in
+func (s *PinStore) Path() string {
+	return s.path
+}
+
+// PinKey returns the key a router's fingerprint is recorded under, its
+// host and port, e.g. "192.168.0.1:443"
+func PinKey(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return u.Hostname() + ":" + port
+}
+
+// Get returns the fingerprint recorded under key
+func (s *PinStore) Get(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pins, err := s.load()
+	if err != nil {
+		return "", false, err
+	}
+	for _, p := range pins {
+		if p[0] == key {
+			return p[1], true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Put records fingerprint under key, replacing any previous fingerprint
+func (s *PinStore) Put(key, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pins, err := s.load()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i, p := range pins {
+		if p[0] == key {
+			pins[i][1] = fingerprint
+			found = true
+		}
+	}
+	if !found {
+		pins = append(pins, [2]string{key, fingerprint})
+	}
+
+	var b strings.Builder
+	for _, p := range pins {
+		fmt.Fprintf(&b, "%s %s\n", p[0], p[1])
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed creating config directory: %w", err)
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", s.path, os.Getpid())
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed writing pinned certificates: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed writing pinned certificates: %w", err)
+	}
+	return nil
+}
+
+// load returns the recorded key and fingerprint pairs in file order
+func (s *PinStore) load() ([][2]string, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading pinned certificates: %w", err)
+	}
+	defer f.Close()
+
+	var pins [][2]string
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected host and fingerprint", s.path, lineNo)
+		}
+		pins = append(pins, [2]string{fields[0], fields[1]})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading pinned certificates: %w", err)
+	}
+	return pins, nil
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config holds the settings shared by all router backends
+type Config struct {
+	BaseURL string
+	User    string
+	Pass    string
+	// Timeout limits every phase without a timeout in Timeouts
+	// (DefaultTimeout if zero)
+	Timeout  time.Duration
+	Timeouts Timeouts
+	Observer Observer
+	// Sessions records open sessions so that a later run can log out a
+	// session left open by a killed process; nothing is recorded if nil
+	Sessions *SessionStore
+	// Retry retries failed logins and host table fetches; the zero value
+	// doesn't retry
+	Retry RetryPolicy
+	// Logger receives leveled logs of logins, sessions and host table
+	// fetches; nothing is logged if nil
+	Logger *slog.Logger
+	// Trace logs every HTTP exchange with the router to Logger at debug
+	// level, with secrets redacted
+	Trace bool
+	// TLS configures certificate verification for https:// routers
+	TLS TLSConfig
+}
+
+// DefaultTimeout limits each phase of talking to a router unless
+// configured otherwise
+const DefaultTimeout = 10 * time.Second
+
+// Timeouts limits the phases of talking to a router. Each phase gets its
+// own deadline, within the deadline of the caller's context if any.
+type Timeouts struct {
+	// Salt limits requesting the login salt (HomeStation only)
+	Salt time.Duration
+	// Login limits sending the credentials and activating the session
+	Login time.Duration
+	// Table limits fetching the host table
+	Table time.Duration
+	// Logout limits ending the session. Logging out is attempted even
+	// after the caller's context was cancelled.
+	Logout time.Duration
+}
+
+// orDefault returns t with unset phases limited to d, or DefaultTimeout if
+// d is not positive either
+func (t Timeouts) orDefault(d time.Duration) Timeouts {
+	if d <= 0 {
+		d = DefaultTimeout
+	}
+	for _, p := range []*time.Duration{&t.Salt, &t.Login, &t.Table, &t.Logout} {
+		if *p <= 0 {
+			*p = d
+		}
+	}
+	return t
+}
+
+// Factory creates a RouterClient for a backend
+type Factory func(cfg Config) (RouterClient, error)
+
+// Backend is a registered backend
+type Backend struct {
+	// New creates a client for the backend
+	New Factory
+	// Emulated marks a backend running a router emulator in-process, such
+	// as the CLI's fake backend. It accepts any password, is served over
+	// plain HTTP and its sessions end with the process, so callers need not
+	// resolve a password, verify a certificate or record sessions.
+	Emulated bool
+}
+
+var backends = map[string]Backend{}
+
+// Register makes a backend available under name. It panics if the name is
+// already taken, as that is a programming error.
+func Register(name string, f Factory) {
+	RegisterBackend(name, Backend{New: f})
+}
+
+// RegisterBackend is Register with the backend's metadata
+func RegisterBackend(name string, b Backend) {
+	if _, dup := backends[name]; dup {
+		panic("router: backend registered twice: " + name)
+	}
+	backends[name] = b
+}
+
+// Backends returns the names of all registered backends, sorted
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupBackend returns the backend registered under name
+func LookupBackend(name string) (Backend, error) {
+	b, ok := backends[name]
+	if !ok {
+		return Backend{}, fmt.Errorf("unknown router type %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+	return b, nil
+}
+
+// New creates a RouterClient using the backend registered under name
+func New(name string, cfg Config) (RouterClient, error) {
+	b, err := LookupBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.New(cfg)
+}
@@ -0,0 +1,147 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// RetryPolicy decides whether and when failed logins and host table
+// fetches are retried. The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts per phase including the first
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry; it doubles with
+	// every further retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter varies every wait randomly by up to this fraction, e.g. 0.2
+	// for ±20%, so that several clients don't retry in lockstep
+	Jitter float64
+	// LockoutWait is the wait before logging in again after the router
+	// refused the login because another session is active (MSG_LOGIN_150).
+	// Quick retries would only prolong the lockout, so the login is not
+	// retried at all if zero.
+	LockoutWait time.Duration
+	// Retryable reports whether an error is transient; DefaultRetryable if
+	// nil. Lockouts are always handled through LockoutWait.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy retries transient errors twice within a few seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.2,
+}
+
+// statusError is an HTTP error status from the router
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("router answered with HTTP status %d", e.code)
+}
+
+// DefaultRetryable reports whether err is likely to go away on its own:
+// ErrUnreachable errors such as network errors, timeouts and HTTP 5xx and
+// 429 answers, and ErrProtocol errors without a router code, as caused by
+// malformed responses of routers that are still booting. Wrong credentials,
+// untrusted certificates, error codes and expired sessions are not retried.
+func DefaultRetryable(err error) bool {
+	if errors.Is(err, errSessionExpired) || sessionRejected(err) {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind == ErrUnreachable || (e.Kind == ErrProtocol && e.Code == "")
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == 429
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// lockedOut reports whether the router refused a login because another
+// session is active
+func lockedOut(err error) bool {
+	return errors.Is(err, ErrSessionActive)
+}
+
+// backoff returns the wait before the next attempt after attempt failed
+// with err, or false if err is not retried
+func (p RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+
+	var d time.Duration
+	switch {
+	case lockedOut(err):
+		if p.LockoutWait <= 0 {
+			return 0, false
+		}
+		d = p.LockoutWait
+	case !retryable(err):
+		return 0, false
+	default:
+		d = p.InitialBackoff
+		for i := 1; i < attempt; i++ {
+			d *= 2
+			if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+				d = p.MaxBackoff
+				break
+			}
+		}
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d, true
+}
+
+// Do calls f until it succeeds, fails with an error that isn't retried or
+// ctx ends, and returns its last error, waiting between attempts like the
+// router clients do. Retries are logged to logger (if not nil) as phase.
+// Other packages set Retryable for their own errors.
+func (p RetryPolicy) Do(ctx context.Context, logger *slog.Logger, phase string, f func() error) error {
+	return p.do(ctx, discardLogger(logger), phase, f)
+}
+
+// do calls f until it succeeds, fails with an error that isn't retried or
+// ctx ends, and returns its last error. Retries are logged as phase.
+func (p RetryPolicy) do(ctx context.Context, logger *slog.Logger, phase string, f func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		wait, ok := p.backoff(attempt, err)
+		if !ok || ctx.Err() != nil {
+			return err
+		}
+
+		logger.Info("retrying", "phase", phase, "attempt", attempt+1, "wait", wait, "error", err)
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router/homestationtest"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	for attempt, want := range []time.Duration{100, 200, 300, 300} {
+		if d, ok := p.backoff(attempt+1, netErr); !ok || d != want*time.Millisecond {
+			t.Errorf("attempt %d: got %s, %v, want %s", attempt+1, d, ok, want*time.Millisecond)
+		}
+	}
+	if _, ok := p.backoff(5, netErr); ok {
+		t.Error("expected no retry after MaxAttempts")
+	}
+	if _, ok := p.backoff(1, &statusError{code: 503}); !ok {
+		t.Error("expected HTTP 503 to be retried")
+	}
+	if _, ok := p.backoff(1, &Error{Kind: ErrProtocol, Err: errors.New("no salt returned from router")}); !ok {
+		t.Error("expected a malformed response to be retried")
+	}
+	for _, err := range []error{
+		errors.New("login failed with provided credentials"),
+		&Error{Kind: ErrBadCredentials, Code: "MSG_LOGIN_1"},
+		&Error{Kind: ErrProtocol, Code: "6", Err: &ubusError{code: 6}},
+		&statusError{code: 404},
+		&Error{Kind: ErrProtocol, Err: errSessionExpired},
+	} {
+		if _, ok := p.backoff(1, err); ok {
+			t.Errorf("expected %v not to be retried", err)
+		}
+	}
+
+	lockout := &Error{Kind: ErrSessionActive, Code: "MSG_LOGIN_150"}
+	if _, ok := p.backoff(1, lockout); ok {
+		t.Error("expected lockouts not to be retried without LockoutWait")
+	}
+	p.LockoutWait = time.Minute
+	if d, ok := p.backoff(1, lockout); !ok || d != time.Minute {
+		t.Errorf("lockout: got %s, %v, want 1m", d, ok)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d, _ := p.backoff(1, netErr); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered backoff %s out of range", d)
+		}
+	}
+
+	p.Retryable = func(error) bool { return false }
+	if _, ok := p.backoff(1, netErr); ok {
+		t.Error("expected a custom Retryable to override the default")
+	}
+}
+
+func TestHomeStationRetries(t *testing.T) {
+	retry := WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	t.Run("retries a booting router", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.FailNext("/api/v1/session/login", 1, homestationtest.FaultReset)
+		f.FailNext("/api/v1/session/login", 1, homestationtest.FaultUnavailable)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret", retry)
+
+		if _, err := c.ListConnected(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s := f.Stats(); s.Logins != 1 || s.Logouts != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("retries the host table", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.FailNext("/api/v1/host/hostTbl", 1, homestationtest.FaultUnavailable)
+		o := &recordingObserver{}
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret", retry, WithObserver(o))
+
+		if _, err := c.ListConnected(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if s := f.Stats(); s.Logins != 1 || s.HostTables != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+		if len(o.fetches) != 2 || o.fetches[0] == nil || o.fetches[1] != nil {
+			t.Errorf("expected a failed and a successful fetch, got %v", o.fetches)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.FailNext("", 100, homestationtest.FaultUnavailable)
+		o := &recordingObserver{}
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret", retry, WithObserver(o))
+
+		_, err := c.ListConnected()
+		var se *statusError
+		if !errors.As(err, &se) || se.code != 503 {
+			t.Fatalf("expected HTTP 503 error, got %v", err)
+		}
+		if len(o.failures) != 3 {
+			t.Errorf("expected 3 attempts, got %v", o.failures)
+		}
+	})
+
+	t.Run("doesn't retry wrong passwords", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		c, _ := NewHomeStationClient(f.URL, "admin", "wrong", retry)
+
+		if _, err := c.ListConnected(); err == nil {
+			t.Fatal("expected error for wrong password")
+		}
+		if s := f.Stats(); s.FailedLogins != 1 {
+			t.Errorf("expected a single login attempt, got %+v", s)
+		}
+	})
+
+	t.Run("waits out a lockout", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureSessionActive)
+		time.AfterFunc(20*time.Millisecond, func() { f.SetFailure(homestationtest.FailureNone) })
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret",
+			WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, LockoutWait: 100 * time.Millisecond}))
+
+		start := time.Now()
+		if _, err := c.ListConnected(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d := time.Since(start); d < 100*time.Millisecond {
+			t.Errorf("expected to wait for the lockout, took %s", d)
+		}
+		if s := f.Stats(); s.FailedLogins != 1 || s.Logins != 1 {
+			t.Errorf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("doesn't retry a lockout without LockoutWait", func(t *testing.T) {
+		f := newFakeHomeStation(t, "admin", "secret", backendDevices)
+		f.SetFailure(homestationtest.FailureSessionActive)
+		c, _ := NewHomeStationClient(f.URL, "admin", "secret", retry)
+
+		if _, err := c.ListConnected(); err == nil || !strings.Contains(err.Error(), "MSG_LOGIN_150") {
+			t.Fatalf("expected MSG_LOGIN_150, got %v", err)
+		}
+		if s := f.Stats(); s.FailedLogins != 1 {
+			t.Errorf("expected a single login attempt, got %+v", s)
+		}
+	})
+}
@@ -1,11 +1,67 @@
 package router
 
+import (
+	"context"
+	"strings"
+
+	"github.com/bastibuck/am-i-home-cli/internal/oui"
+)
+
 // Device represents a device connected to the router
 type Device struct {
-	MAC      string
-	IP       string
-	Hostname string
-	Active   bool
+	MAC      string `json:"mac"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname"`
+	Active   bool   `json:"active"`
+
+	// Optional details, zero if the backend does not report them
+	Interface        string   `json:"interface,omitempty"` // "ethernet" or "wifi"
+	Band             string   `json:"band,omitempty"`      // Wi-Fi band: "2.4GHz", "5GHz" or "6GHz"
+	SSID             string   `json:"ssid,omitempty"`
+	Signal           int      `json:"signal,omitempty"` // Wi-Fi RSSI in dBm
+	IPv6             []string `json:"ipv6,omitempty"`
+	LeaseSeconds     int64    `json:"lease_seconds,omitempty"`     // remaining DHCP lease time
+	ConnectedSeconds int64    `json:"connected_seconds,omitempty"` // time since the device connected
+	Vendor           string   `json:"vendor,omitempty"`
+	// Randomized is set for locally administered MAC addresses, which
+	// phones and laptops randomize per network and may rotate over time
+	Randomized bool `json:"randomized,omitempty"`
+	// LinkedMACs are other randomized MAC addresses believed to belong to
+	// the same device (see history.Links). Only linked: matchers match
+	// them.
+	LinkedMACs []string `json:"linked_macs,omitempty"`
+}
+
+// identify fills in Vendor from the embedded OUI database unless the router
+// reported one, and flags locally administered MAC addresses
+func identify(d Device) Device {
+	d.Randomized = oui.LocallyAdministered(d.MAC)
+	if d.Vendor == "" {
+		d.Vendor = oui.Lookup(d.MAC)
+	}
+	return d
+}
+
+// Interface types of Device.Interface
+const (
+	InterfaceEthernet = "ethernet"
+	InterfaceWiFi     = "wifi"
+)
+
+// NormalizeBand returns a Wi-Fi band in the form used by Device.Band, e.g.
+// "5GHz" for "5G", "5 GHz" or "5ghz". Unknown values are returned as is.
+func NormalizeBand(band string) string {
+	b := strings.ToLower(strings.ReplaceAll(band, " ", ""))
+	b = strings.TrimSuffix(strings.TrimSuffix(b, "hz"), "g")
+	switch b {
+	case "2.4", "2":
+		return "2.4GHz"
+	case "5":
+		return "5GHz"
+	case "6":
+		return "6GHz"
+	}
+	return band
 }
 
 // RouterClient abstracts fetching connected devices
@@ -13,9 +69,43 @@ type RouterClient interface {
 	ListConnected() ([]Device, error)
 }
 
-// normalizeMAC returns a canonical MAC format used for comparisons:
+// SessionClient is a RouterClient that can keep one authenticated session
+// open across multiple ListConnected calls
+type SessionClient interface {
+	RouterClient
+	Login() error
+	Close() error
+}
+
+// SessionResetter is implemented by clients that can end a session left
+// open by an earlier run (see SessionStore)
+type SessionResetter interface {
+	// ResetSession logs out the session recorded for the client's router
+	// and user and reports whether there was one. A session whose process
+	// is still running is only logged out with force.
+	ResetSession(ctx context.Context, force bool) (bool, error)
+}
+
+// ContextClient is a RouterClient whose requests can be cancelled through
+// a context. Cancelling a call still attempts to log out of the router, so
+// that no session is left blocking the next login.
+type ContextClient interface {
+	RouterClient
+	ListConnectedContext(ctx context.Context) ([]Device, error)
+}
+
+// ListConnectedContext lists the devices of c, passing ctx along if c
+// implements ContextClient. Other clients can't be cancelled and ignore ctx.
+func ListConnectedContext(ctx context.Context, c RouterClient) ([]Device, error) {
+	if cc, ok := c.(ContextClient); ok {
+		return cc.ListConnectedContext(ctx)
+	}
+	return c.ListConnected()
+}
+
+// NormalizeMAC returns a canonical MAC format used for comparisons:
 // lowercase with no separators.
-func normalizeMAC(mac string) string {
+func NormalizeMAC(mac string) string {
 	b := make([]byte, 0, len(mac))
 	for i := 0; i < len(mac); i++ {
 		c := mac[i]
@@ -33,5 +123,12 @@ func normalizeMAC(mac string) string {
 
 // MatchMAC compares two MAC addresses for equality after normalization
 func MatchMAC(a, b string) bool {
-	return normalizeMAC(a) == normalizeMAC(b)
+	return NormalizeMAC(a) == NormalizeMAC(b)
+}
+
+// MatchDevice reports whether a device matches a matcher expression (see
+// ParseMatcher), e.g. a MAC address, hostname or IP. Invalid expressions
+// only match literally.
+func MatchDevice(d Device, matcher string) bool {
+	return compiledMatcher(matcher)(d)
 }
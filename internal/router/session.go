@@ -0,0 +1,197 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/config"
+	"github.com/bastibuck/am-i-home-cli/internal/filelock"
+)
+
+// ErrSessionInUse is returned when resetting a session whose process is
+// still running
+var ErrSessionInUse = errors.New("the session is in use")
+
+// Session is a router session recorded in a SessionStore while it is open
+type Session struct {
+	// Cookies hold a HomeStation session
+	Cookies map[string]string `json:"cookies,omitempty"`
+	// ID is an OpenWrt ubus session
+	ID string `json:"id,omitempty"`
+	// PID is the process that logged in
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// Stale reports whether the process that opened the session is gone, so
+// that nobody is going to log it out
+func (s Session) Stale() bool {
+	if s.PID == os.Getpid() {
+		return false
+	}
+	p, err := os.FindProcess(s.PID)
+	if err != nil {
+		return true
+	}
+	// signal 0 only checks whether the process exists; EPERM means it
+	// exists but belongs to another user
+	err = p.Signal(syscall.Signal(0))
+	return err != nil && !errors.Is(err, syscall.EPERM)
+}
+
+// SessionStore records open router sessions in a file, so that a session
+// left open by a process that was killed before it could log out can be
+// ended by the next run instead of blocking its login with MSG_LOGIN_150.
+// Every process records its own session; the file holds session cookies
+// and is only readable by its owner.
+type SessionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// DefaultSessionPath returns the default session file (usually
+// ~/.local/state/am-i-home/sessions.json), "" if there is no state
+// directory
+func DefaultSessionPath() string {
+	dir := config.StateDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "sessions.json")
+}
+
+// NewSessionStore returns a SessionStore for path. The file is created
+// when the first session is recorded.
+func NewSessionStore(path string) *SessionStore {
+	return &SessionStore{path: path}
+}
+
+// SessionKey returns the key a session is recorded under, e.g.
+// "admin@192.168.0.1". The scheme of router is ignored.
+func SessionKey(user, router string) string {
+	if _, rest, ok := strings.Cut(router, "://"); ok {
+		router = rest
+	}
+	return user + "@" + strings.TrimSuffix(router, "/")
+}
+
+// Sessions returns the sessions recorded under key, one per process
+// holding one, oldest first
+func (s *SessionStore) Sessions(key string) ([]Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return sessions[key], nil
+}
+
+// Put records sess under key, replacing the session recorded by the same
+// process
+func (s *SessionStore) Put(key string, sess Session) error {
+	return s.update(func(sessions map[string][]Session) {
+		list := slices.DeleteFunc(sessions[key], func(o Session) bool { return o.PID == sess.PID })
+		sessions[key] = append(list, sess)
+	})
+}
+
+// Remove forgets the session the process pid recorded under key. Sessions
+// of other processes are kept.
+func (s *SessionStore) Remove(key string, pid int) error {
+	return s.update(func(sessions map[string][]Session) {
+		list := slices.DeleteFunc(sessions[key], func(o Session) bool { return o.PID == pid })
+		if len(list) == 0 {
+			delete(sessions, key)
+		} else {
+			sessions[key] = list
+		}
+	})
+}
+
+// update applies fn to the recorded sessions and saves them, holding a
+// lock file so that concurrent processes don't overwrite each other's
+// sessions
+func (s *SessionStore) update(fn func(map[string][]Session)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := filelock.Lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sessions, err := s.load()
+	if err != nil {
+		return err
+	}
+	fn(sessions)
+	return s.save(sessions)
+}
+
+func (s *SessionStore) load() (map[string][]Session, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string][]Session{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading sessions: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed parsing sessions %s: %w", s.path, err)
+	}
+	sessions := make(map[string][]Session, len(raw))
+	for key, v := range raw {
+		var list []Session
+		if strings.HasPrefix(strings.TrimSpace(string(v)), "{") {
+			// a single session, as recorded by earlier versions
+			list = make([]Session, 1)
+			err = json.Unmarshal(v, &list[0])
+		} else {
+			err = json.Unmarshal(v, &list)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing sessions %s: %w", s.path, err)
+		}
+		sessions[key] = list
+	}
+	return sessions, nil
+}
+
+// save replaces the file atomically; it is removed once no session is left
+func (s *SessionStore) save(sessions map[string][]Session) error {
+	if len(sessions) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed writing sessions: %w", err)
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed creating state directory: %w", err)
+	}
+	// several processes may save at once
+	tmp := fmt.Sprintf("%s.%d.tmp", s.path, os.Getpid())
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("failed writing sessions: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed writing sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	s := NewSessionStore(filepath.Join(t.TempDir(), "am-i-home", "sessions.json"))
+	key := SessionKey("admin", "https://192.168.0.1/")
+	if key != "admin@192.168.0.1" {
+		t.Errorf("got key %q", key)
+	}
+
+	daemon := Session{ID: "a", PID: 100, Started: time.Now()}
+	check := Session{ID: "b", PID: 200, Started: time.Now()}
+	for _, sess := range []Session{daemon, check, {ID: "c", PID: 200}} {
+		if err := s.Put(key, sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions, err := s.Sessions(key)
+	if err != nil || len(sessions) != 2 || sessions[0].ID != "a" || sessions[1].ID != "c" {
+		t.Fatalf("expected one session per process, got %+v, %v", sessions, err)
+	}
+
+	if err := s.Remove(key, 200); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := s.Sessions(key); len(sessions) != 1 || sessions[0].PID != 100 {
+		t.Errorf("expected the other process's session to be kept, got %+v", sessions)
+	}
+	if err := s.Remove(key, 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed without sessions, got %v", err)
+	}
+}
+
+func TestSessionStoreReadsSingleSessions(t *testing.T) {
+	s := NewSessionStore(filepath.Join(t.TempDir(), "sessions.json"))
+	if err := os.WriteFile(s.path, []byte(`{"admin@192.168.0.1": {"id": "a", "pid": 100}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := s.Sessions("admin@192.168.0.1")
+	if err != nil || len(sessions) != 1 || sessions[0].PID != 100 {
+		t.Errorf("got %+v, %v", sessions, err)
+	}
+}
@@ -0,0 +1,156 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TLSConfig configures how the certificate of a router served over HTTPS
+// is verified. The zero value verifies it against the system's roots.
+type TLSConfig struct {
+	// CAFile is a PEM file with certificates trusted in addition to the
+	// system's roots, e.g. the router's self-signed certificate
+	CAFile string
+	// Fingerprint pins the router's certificate by its SHA-256
+	// fingerprint (see ParseFingerprint). Only that certificate is
+	// accepted, even if it is self-signed or doesn't match the host name.
+	Fingerprint string
+	// InsecureSkipVerify accepts any certificate
+	InsecureSkipVerify bool
+}
+
+// errFingerprintMismatch is returned when the router presents a certificate
+// other than the pinned one
+var errFingerprintMismatch = errors.New("certificate doesn't match the pinned fingerprint")
+
+// Fingerprint returns the SHA-256 fingerprint of cert as colon-separated
+// hex, as printed by openssl x509 -fingerprint -sha256
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// ParseFingerprint decodes a SHA-256 fingerprint written as hex with or
+// without colons and an optional "sha256:" prefix
+func ParseFingerprint(s string) ([]byte, error) {
+	h := strings.TrimSpace(s)
+	if len(h) > 7 && strings.EqualFold(h[:7], "sha256:") {
+		h = h[7:]
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(h, ":", ""))
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 fingerprint %q", s)
+	}
+	return b, nil
+}
+
+// newTransport returns an http.DefaultTransport clone verifying the
+// router's certificate according to c
+func newTransport(c TLSConfig) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c == (TLSConfig{}) {
+		return t, nil
+	}
+	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading CA file: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		t.TLSClientConfig.RootCAs = roots
+	}
+
+	if c.Fingerprint != "" {
+		pin, err := ParseFingerprint(c.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// the pin replaces the usual verification, which a self-signed
+		// certificate would fail
+		t.TLSClientConfig.InsecureSkipVerify = true
+		t.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("router presented no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if string(sum[:]) != string(pin) {
+				return fmt.Errorf("%w: got %s", errFingerprintMismatch, Fingerprint(cs.PeerCertificates[0]))
+			}
+			return nil
+		}
+	}
+	return t, nil
+}
+
+// certificateError reports whether err is a failed certificate check,
+// which is not going to go away by retrying
+func certificateError(err error) bool {
+	var ve *tls.CertificateVerificationError
+	return errors.As(err, &ve) || errors.Is(err, errFingerprintMismatch)
+}
+
+// requestError wraps a failed HTTP request as ErrCertificate or
+// ErrUnreachable
+func requestError(err error) error {
+	if certificateError(err) {
+		return &Error{Kind: ErrCertificate, Err: err}
+	}
+	return &Error{Kind: ErrUnreachable, Err: err}
+}
+
+// ProbeCertificate connects to the HTTPS router at baseURL and returns the
+// fingerprint of its certificate and whether the system's roots trust it,
+// e.g. to pin a self-signed certificate on first use
+func ProbeCertificate(ctx context.Context, baseURL string) (fingerprint string, trusted bool, err error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", false, err
+	}
+	if u.Scheme != "https" {
+		return "", false, fmt.Errorf("%s is not an https URL", baseURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	d := tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true, ServerName: u.Hostname()}}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", false, &Error{Kind: ErrUnreachable, Err: err}
+	}
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	conn.Close()
+	if len(certs) == 0 {
+		return "", false, &Error{Kind: ErrCertificate, Err: errors.New("router presented no certificate")}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{DNSName: u.Hostname(), Intermediates: intermediates})
+	return Fingerprint(certs[0]), err == nil, nil
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router/homestationtest"
+)
+
+func TestHomeStationTLS(t *testing.T) {
+	f := homestationtest.NewTLSServer("admin", "secret", []homestationtest.Host{
+		{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true},
+	})
+	t.Cleanup(f.Close)
+	fingerprint := Fingerprint(f.Certificate())
+
+	caFile := filepath.Join(t.TempDir(), "router.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		tls     TLSConfig
+		wantErr error
+	}{
+		"rejects a self-signed certificate": {TLSConfig{}, ErrCertificate},
+		"trusts the CA file":                {TLSConfig{CAFile: caFile}, nil},
+		"accepts the pinned certificate":    {TLSConfig{Fingerprint: strings.ToLower(fingerprint)}, nil},
+		"rejects another certificate":       {TLSConfig{Fingerprint: strings.Repeat("00", 32)}, ErrCertificate},
+		"skips verification":                {TLSConfig{InsecureSkipVerify: true}, nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := New("homestation", Config{BaseURL: f.URL, User: "admin", Pass: "secret", TLS: tc.tls, Retry: DefaultRetryPolicy})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			devs, err := c.ListConnected()
+			if !errors.Is(err, tc.wantErr) || (err == nil && len(devs) != 1) {
+				t.Fatalf("got %v, %v, want error %v", devs, err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := New("homestation", Config{BaseURL: f.URL, TLS: TLSConfig{Fingerprint: "AB:CD"}}); err == nil {
+		t.Error("expected an error for an invalid fingerprint")
+	}
+
+	got, trusted, err := ProbeCertificate(context.Background(), f.URL)
+	if err != nil || got != fingerprint || trusted {
+		t.Errorf("ProbeCertificate: got %q, %v, %v, want %q, false", got, trusted, err, fingerprint)
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	hex := strings.Repeat("ab", 32)
+	colons := strings.TrimSuffix(strings.Repeat("AB:", 32), ":")
+	for _, s := range []string{hex, colons, "sha256:" + hex, "SHA256:" + colons} {
+		if b, err := ParseFingerprint(s); err != nil || len(b) != 32 || b[0] != 0xab {
+			t.Errorf("%q: got %x, %v", s, b, err)
+		}
+	}
+	for _, s := range []string{"", "ab:cd", "sha1:" + hex, strings.Repeat("zz", 32)} {
+		if _, err := ParseFingerprint(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestPinStore(t *testing.T) {
+	s := NewPinStore(filepath.Join(t.TempDir(), "am-i-home", "known_routers"))
+	key := PinKey("https://192.168.0.1/")
+	if key != "192.168.0.1:443" {
+		t.Errorf("got key %q", key)
+	}
+
+	if _, ok, err := s.Get(key); ok || err != nil {
+		t.Fatalf("expected no pin, got %v, %v", ok, err)
+	}
+	if err := s.Put(key, "AA:BB"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("router.lan:8443", "CC:DD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(key, "EE:FF"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fp, ok, err := s.Get(key); fp != "EE:FF" || !ok || err != nil {
+		t.Errorf("got %q, %v, %v, want EE:FF", fp, ok, err)
+	}
+	b, _ := os.ReadFile(s.Path())
+	if want := "192.168.0.1:443 EE:FF\nrouter.lan:8443 CC:DD\n"; string(b) != want {
+		t.Errorf("got file %q, want %q", b, want)
+	}
+}
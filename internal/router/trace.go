@@ -0,0 +1,220 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redacted replaces secrets in logs and traces
+const redacted = "REDACTED"
+
+// maxTraceBody is how much of a request or response body is traced
+const maxTraceBody = 4096
+
+// sensitiveKeys are form fields and JSON keys whose values are redacted
+// (compared case-insensitively)
+var sensitiveKeys = map[string]bool{
+	"password": true, "passwd": true, "pass": true, "secret": true,
+	"token": true, "csrf_token": true, "csrftoken": true, "apikey": true,
+	"salt": true, "saltwebui": true,
+	"sessionid": true, "ubus_rpc_session": true,
+}
+
+// sensitiveHeaders are headers whose values are redacted
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true, "Proxy-Authorization": true,
+	"X-Csrf-Token": true, "X-Auth-Token": true,
+}
+
+// hexSecret matches password hashes and session ids in free text
+var hexSecret = regexp.MustCompile(`\b[0-9a-fA-F]{32,}\b`)
+
+// discardLogger returns l, or a logger discarding everything if l is nil
+func discardLogger(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return l
+}
+
+// traceTransport logs every HTTP exchange at debug level with passwords,
+// hashes, cookies and tokens redacted, e.g. to attach to a bug report
+type traceTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+// newTraceTransport wraps base (http.DefaultTransport if nil)
+func newTraceTransport(base http.RoundTripper, logger *slog.Logger) *traceTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &traceTransport{base: base, logger: logger}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	t.logger.Debug("http request",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"headers", redactHeaders(req.Header),
+		"body", redactBody(req.Header.Get("Content-Type"), reqBody),
+	)
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.logger.Debug("http error", "method", req.Method, "url", redactURL(req.URL), "duration", time.Since(start), "error", err)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.logger.Debug("http error", "method", req.Method, "url", redactURL(req.URL), "duration", time.Since(start), "error", err)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.logger.Debug("http response",
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"headers", redactHeaders(resp.Header),
+		"body", redactBody(resp.Header.Get("Content-Type"), body),
+	)
+	return resp, nil
+}
+
+// redactURL redacts credentials and sensitive query parameters
+func redactURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		c.User = url.User(redacted)
+	}
+	if c.RawQuery != "" {
+		c.RawQuery = redactForm(c.RawQuery)
+	}
+	return c.String()
+}
+
+// redactHeaders renders headers sorted by name, one "Name: value" per line.
+// Cookie values are redacted, their names kept.
+func redactHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, v := range h[name] {
+			switch {
+			case sensitiveHeaders[name]:
+				v = redacted
+			case name == "Cookie":
+				cookies := strings.Split(v, ";")
+				for i, c := range cookies {
+					k, _, _ := strings.Cut(strings.TrimSpace(c), "=")
+					cookies[i] = k + "=" + redacted
+				}
+				v = strings.Join(cookies, "; ")
+			case name == "Set-Cookie":
+				k, rest, _ := strings.Cut(v, "=")
+				_, attrs, hasAttrs := strings.Cut(rest, ";")
+				v = k + "=" + redacted
+				if hasAttrs {
+					v += ";" + attrs
+				}
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, v)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// redactBody renders a request or response body with secrets redacted,
+// truncated to maxTraceBody
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var s string
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		s = redactForm(string(body))
+	case json.Valid(body):
+		var v any
+		json.Unmarshal(body, &v)
+		b, _ := json.Marshal(redactJSON(v))
+		s = string(b)
+	default:
+		s = string(body)
+	}
+	s = hexSecret.ReplaceAllStringFunc(s, func(m string) string {
+		// keep the all-zero null session of ubus recognizable
+		if strings.Trim(m, "0") == "" {
+			return m
+		}
+		return redacted
+	})
+
+	if len(s) > maxTraceBody {
+		s = fmt.Sprintf("%s... (%d bytes)", s[:maxTraceBody], len(s))
+	}
+	return s
+}
+
+// redactForm redacts sensitive fields of a URL-encoded form, keeping the
+// order of the fields
+func redactForm(form string) string {
+	fields := strings.Split(form, "&")
+	for i, f := range fields {
+		k, _, ok := strings.Cut(f, "=")
+		name, err := url.QueryUnescape(k)
+		if ok && err == nil && sensitiveKeys[strings.ToLower(name)] {
+			fields[i] = k + "=" + redacted
+		}
+	}
+	return strings.Join(fields, "&")
+}
+
+// redactJSON redacts the values of sensitive keys in a decoded JSON value
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if sensitiveKeys[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSON(e)
+		}
+	}
+	return v
+}
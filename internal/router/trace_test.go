@@ -0,0 +1,55 @@
+package router
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bastibuck/am-i-home-cli/internal/router/homestationtest"
+)
+
+func TestHTTPTraceRedactsSecrets(t *testing.T) {
+	f := homestationtest.NewServer("admin", "hunter2", []homestationtest.Host{
+		{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true},
+	})
+	defer f.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, _ := NewHomeStationClient(f.URL, "admin", "hunter2", WithLogger(logger), WithHTTPTrace())
+	if _, err := c.ListConnected(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	log := buf.String()
+	for _, want := range []string{`msg="http request"`, `msg="http response"`, "hostTbl", "phone", "PHPSESSID=REDACTED", `\"salt\":\"REDACTED\"`} {
+		if !strings.Contains(log, want) {
+			t.Errorf("expected trace to contain %s", want)
+		}
+	}
+	if strings.Contains(log, "hunter2") {
+		t.Error("trace contains the password")
+	}
+	if m := regexp.MustCompile(`PHPSESSID=[^R]|[0-9a-f]{32}|password=[^R]`).FindString(log); m != "" {
+		t.Errorf("trace contains a secret: %q", m)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		contentType, body, want string
+	}{
+		{"application/x-www-form-urlencoded", "username=admin&password=s3cret", "username=admin&password=REDACTED"},
+		{"application/json", `{"params":["0123456789abcdef0123456789abcdef","session","login",{"password":"x","username":"root"}]}`,
+			`{"params":["REDACTED","session","login",{"password":"REDACTED","username":"root"}]}`},
+		{"application/json", `{"params":["00000000000000000000000000000000"]}`, `{"params":["00000000000000000000000000000000"]}`},
+		{"text/html", "<html>token 0123456789abcdef0123456789abcdef</html>", "<html>token REDACTED</html>"},
+	}
+	for _, tt := range tests {
+		if got := redactBody(tt.contentType, []byte(tt.body)); got != tt.want {
+			t.Errorf("redactBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
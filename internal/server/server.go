@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/metrics"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// Server exposes the devices of a RouterClient over HTTP. Host table results
+// are cached for the configured TTL so that many consumers share a single
+// router session instead of each logging in themselves.
+type Server struct {
+	client  router.RouterClient
+	ttl     time.Duration
+	metrics *metrics.Collector
+	aliases map[string]string
+
+	mu      sync.Mutex
+	devices []router.Device
+	fetched time.Time
+}
+
+// Option configures optional Server behaviour
+type Option func(*Server)
+
+// WithMetrics serves the collector's metrics on GET /metrics
+func WithMetrics(m *metrics.Collector) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithAliases resolves friendly names in /check/{matcher} to device matchers
+func WithAliases(aliases map[string]string) Option {
+	return func(s *Server) {
+		s.aliases = aliases
+	}
+}
+
+// New creates a Server that caches router results for ttl (0 disables caching)
+func New(c router.RouterClient, ttl time.Duration, opts ...Option) *Server {
+	s := &Server{client: c, ttl: ttl}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handler returns the HTTP handler serving the presence API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /devices", s.handleDevices)
+	mux.HandleFunc("GET /devices/active", s.handleActive)
+	mux.HandleFunc("GET /check/{matcher}", s.handleCheck)
+	if s.metrics != nil {
+		mux.HandleFunc("GET /metrics", s.handleMetrics)
+	}
+	return mux
+}
+
+// Serve listens on addr until ctx is cancelled. Clients supporting sessions
+// are logged in once up front and logged out on shutdown.
+func (s *Server) Serve(ctx context.Context, addr string) error {
+	if sc, ok := s.client.(router.SessionClient); ok {
+		if err := sc.Login(); err != nil {
+			return err
+		}
+		defer sc.Close()
+	}
+
+	srv := &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// snapshot returns the cached host table, refreshing it once the TTL expired.
+// ctx is the request's, so a client hanging up cancels the refresh.
+func (s *Server) snapshot(ctx context.Context) ([]router.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.devices != nil && time.Since(s.fetched) < s.ttl {
+		return s.devices, nil
+	}
+
+	devs, err := router.ListConnectedContext(ctx, s.client)
+	if err != nil {
+		return nil, err
+	}
+	if devs == nil {
+		devs = []router.Device{}
+	}
+	s.devices = devs
+	s.fetched = time.Now()
+	return devs, nil
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	devs, err := s.snapshot(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, devs)
+}
+
+func (s *Server) handleActive(w http.ResponseWriter, r *http.Request) {
+	devs, err := s.snapshot(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	active := []router.Device{}
+	for _, d := range devs {
+		if d.Active {
+			active = append(active, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, active)
+}
+
+// checkResponse mirrors the CLI's check output
+type checkResponse struct {
+	Matcher string `json:"matcher"`
+	Found   bool   `json:"found"`
+}
+
+// handleCheck answers 200 if the matcher is active and 404 if it is not,
+// matching the CLI's exit codes 0 and 1, and 400 for an invalid matcher
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	matcher := r.PathValue("matcher")
+
+	resolved := matcher
+	if m, ok := s.aliases[matcher]; ok {
+		resolved = m
+	}
+	// compiled per request rather than through MatchDevice's cache, which
+	// also matches invalid expressions literally
+	match, err := router.ParseMatcher(resolved)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	devs, err := s.snapshot(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	found := false
+	for _, d := range devs {
+		if d.Active && match(d) {
+			found = true
+			break
+		}
+	}
+
+	status := http.StatusOK
+	if !found {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, checkResponse{Matcher: matcher, Found: found})
+}
+
+// handleMetrics refreshes the device snapshot (subject to the cache TTL) and
+// writes all metrics in the Prometheus text format. Router failures are
+// reported through am_i_home_up rather than an error status.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	devs, err := s.snapshot(r.Context())
+	s.metrics.SetDevices(devs, err)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.metrics.WriteTo(w)
+}
+
+// writeError reports a router failure as 502, the HTTP equivalent of exit code 2
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
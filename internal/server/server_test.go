@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastibuck/am-i-home-cli/internal/metrics"
+	"github.com/bastibuck/am-i-home-cli/internal/router"
+)
+
+// fakeClient is a RouterClient returning a fixed host table
+type fakeClient struct {
+	devices []router.Device
+	err     error
+	calls   int
+}
+
+func (f *fakeClient) ListConnected() ([]router.Device, error) {
+	f.calls++
+	return f.devices, f.err
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{devices: []router.Device{
+		{MAC: "AA:BB:CC:DD:EE:01", IP: "192.168.0.10", Hostname: "phone", Active: true},
+		{MAC: "AA:BB:CC:DD:EE:02", IP: "192.168.0.20", Hostname: "laptop", Active: false},
+	}}
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestDevices(t *testing.T) {
+	h := New(newFakeClient(), 0).Handler()
+
+	rec := get(t, h, "/devices")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var devs []router.Device
+	if err := json.Unmarshal(rec.Body.Bytes(), &devs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(devs) != 2 {
+		t.Errorf("expected 2 devices, got %d", len(devs))
+	}
+}
+
+func TestActiveDevices(t *testing.T) {
+	h := New(newFakeClient(), 0).Handler()
+
+	rec := get(t, h, "/devices/active")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var devs []router.Device
+	if err := json.Unmarshal(rec.Body.Bytes(), &devs); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(devs) != 1 || devs[0].Hostname != "phone" {
+		t.Errorf("expected only the phone, got %+v", devs)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	h := New(newFakeClient(), 0).Handler()
+
+	tests := []struct {
+		path   string
+		status int
+		found  bool
+	}{
+		{"/check/phone", http.StatusOK, true},
+		{"/check/aa-bb-cc-dd-ee-01", http.StatusOK, true},
+		{"/check/192.168.0.10", http.StatusOK, true},
+		{"/check/laptop", http.StatusNotFound, false},
+		{"/check/unknown", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		rec := get(t, h, tt.path)
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.status, rec.Code)
+		}
+		var res checkResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tt.path, err)
+		}
+		if res.Found != tt.found {
+			t.Errorf("%s: expected found=%t, got %t", tt.path, tt.found, res.Found)
+		}
+	}
+}
+
+func TestCheckInvalidMatcher(t *testing.T) {
+	h := New(newFakeClient(), 0).Handler()
+	for _, path := range []string{"/check/phone-%5B", "/check/host:%2F(%2F", "/check/signal:strong"} {
+		rec := get(t, h, path)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected %d, got %d", path, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
+
+func TestCheckResolvesAliases(t *testing.T) {
+	h := New(newFakeClient(), 0, WithAliases(map[string]string{"alice": "AA:BB:CC:DD:EE:01"})).Handler()
+
+	rec := get(t, h, "/check/alice")
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+	var res checkResponse
+	json.Unmarshal(rec.Body.Bytes(), &res)
+	if res.Matcher != "alice" {
+		t.Errorf("expected response to echo the alias, got %q", res.Matcher)
+	}
+}
+
+func TestRouterErrorIsBadGateway(t *testing.T) {
+	c := newFakeClient()
+	c.err = errors.New("login failed")
+	h := New(c, 0).Handler()
+
+	for _, path := range []string{"/devices", "/devices/active", "/check/phone"} {
+		rec := get(t, h, path)
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected 502, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestResultsAreCached(t *testing.T) {
+	c := newFakeClient()
+	h := New(c, time.Minute).Handler()
+
+	get(t, h, "/devices")
+	get(t, h, "/devices/active")
+	get(t, h, "/check/phone")
+
+	if c.calls != 1 {
+		t.Errorf("expected 1 router call, got %d", c.calls)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("not served without collector", func(t *testing.T) {
+		h := New(newFakeClient(), 0).Handler()
+		if rec := get(t, h, "/metrics"); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("exposes device gauges", func(t *testing.T) {
+		h := New(newFakeClient(), 0, WithMetrics(metrics.NewCollector())).Handler()
+
+		rec := get(t, h, "/metrics")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{
+			"am_i_home_up 1\n",
+			`am_i_home_device_active{mac="AA:BB:CC:DD:EE:01",hostname="phone",ip="192.168.0.10"} 1`,
+			`am_i_home_device_active{mac="AA:BB:CC:DD:EE:02",hostname="laptop",ip="192.168.0.20"} 0`,
+			"am_i_home_devices_known 2\n",
+			"am_i_home_devices_active 1\n",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+			}
+		}
+	})
+
+	t.Run("router failure marks router down", func(t *testing.T) {
+		c := newFakeClient()
+		c.err = errors.New("login failed")
+		h := New(c, 0, WithMetrics(metrics.NewCollector())).Handler()
+
+		rec := get(t, h, "/metrics")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "am_i_home_up 0\n") {
+			t.Errorf("expected am_i_home_up 0, got:\n%s", rec.Body.String())
+		}
+	})
+}